@@ -0,0 +1,44 @@
+package fractus
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// ErrChecksumMismatch is returned when a checksummed payload does not match
+// its checksum trailer.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// checksumMarker starts checksummed payloads written without an envelope.
+// It reads as a field count of 0 written in two bytes, which writeVarUint
+// never produces, so it cannot be mistaken for the start of a plain struct
+// encoding.
+const checksumMarker = "\x80\x00"
+
+// checksumLen is the size of the CRC-32C trailer.
+const checksumLen = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// appendChecksum appends the CRC-32C of b[start:], a payload begun with
+// startFrame, when SafeOptions.Checksum is set.
+func (f *Fractus) appendChecksum(b []byte, start int) []byte {
+	if !f.Opts.Checksum {
+		return b
+	}
+	return binary.LittleEndian.AppendUint32(b, crc32.Checksum(b[start:], castagnoli))
+}
+
+// verifyChecksum checks the CRC-32C trailer of in, a payload whose body
+// starts at base, and returns the body.
+func verifyChecksum(in []byte, base int) ([]byte, error) {
+	end := len(in) - checksumLen
+	if end < base {
+		return nil, decodeErr(len(in), -1, ErrTruncated)
+	}
+	if crc32.Checksum(in[:end], castagnoli) != binary.LittleEndian.Uint32(in[end:]) {
+		return nil, decodeErr(end, -1, ErrChecksumMismatch)
+	}
+	return in[base:end:end], nil
+}
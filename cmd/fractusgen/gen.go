@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/rawbytedev/fractus"
+	"github.com/rawbytedev/fractus/internal/tags"
+)
+
+// generator emits MarshalFractus/UnmarshalFractus for the queued structs.
+// Every emitted construct mirrors a branch of the reflective encoder, so the
+// two must change together.
+type generator struct {
+	pkg     *types.Package
+	buf     bytes.Buffer
+	queue   []*types.Named
+	queued  map[*types.Named]bool
+	imports map[string]string // path -> name
+	tmp     int
+	field   int // struct index of the field being decoded, for FieldError
+	depth   int // nesting of the value being decoded below its struct
+}
+
+// genField is the generator's view of a FieldInfo.
+type genField struct {
+	idx       int    // index in the Go struct, reported in decode errors
+	name      string // Go field name
+	typ       types.Type
+	id        int
+	omitEmpty bool
+}
+
+func newGenerator(pkg *types.Package) *generator {
+	return &generator{
+		pkg:     pkg,
+		queued:  make(map[*types.Named]bool),
+		imports: map[string]string{"github.com/rawbytedev/fractus": "fractus"},
+	}
+}
+
+func (g *generator) p(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// name returns a fresh identifier with the given prefix.
+func (g *generator) name(prefix string) string {
+	g.tmp++
+	return fmt.Sprintf("%s%d", prefix, g.tmp)
+}
+
+// typeName formats t for use in the generated file, recording imports.
+func (g *generator) typeName(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+func (g *generator) enqueue(n *types.Named) {
+	if !g.queued[n] {
+		g.queued[n] = true
+		g.queue = append(g.queue, n)
+	}
+}
+
+var (
+	byteSlice = types.NewSlice(types.Typ[types.Byte])
+	// signatures of fractus.Marshaler and fractus.Unmarshaler
+	marshalSig = types.NewSignatureType(nil, nil, nil,
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", byteSlice)),
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", byteSlice)), false)
+	unmarshalSig = types.NewSignatureType(nil, nil, nil,
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", byteSlice)),
+		types.NewTuple(types.NewParam(token.NoPos, nil, "", types.Universe.Lookup("error").Type())), false)
+)
+
+// custom mirrors fractus' customCodec: types with their own Marshaler and
+// Unmarshaler methods, hand-written or generated for another package, are
+// delegated to.
+func (g *generator) custom(t types.Type) (bool, error) {
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Interface:
+		return false, nil
+	}
+	ms := types.NewMethodSet(types.NewPointer(t))
+	has := func(name string, sig *types.Signature) bool {
+		sel := ms.Lookup(nil, name)
+		return sel != nil && types.Identical(sel.Type(), sig)
+	}
+	m, u := has("MarshalFractus", marshalSig), has("UnmarshalFractus", unmarshalSig)
+	if m != u {
+		return false, fmt.Errorf("%w: %s implements only one of Marshaler and Unmarshaler",
+			fractus.ErrUnsupported, g.typeName(t))
+	}
+	return m, nil
+}
+
+// isCustom is custom for types that already passed check.
+func (g *generator) isCustom(t types.Type) bool {
+	ok, _ := g.custom(t)
+	return ok
+}
+
+// isTime reports whether t is time.Time, which the reflective encoder
+// writes with its built-in time codec.
+func isTime(t types.Type) bool {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() == nil {
+		return false
+	}
+	return n.Obj().Pkg().Path() == "time" && n.Obj().Name() == "Time"
+}
+
+// localStruct reports whether t is a struct defined in the generated
+// package; those get their own methods and are encoded by calling them.
+func (g *generator) localStruct(t types.Type) (*types.Named, bool) {
+	n, ok := types.Unalias(t).(*types.Named)
+	if !ok || n.Obj().Pkg() != g.pkg || n.TypeArgs().Len() > 0 {
+		return nil, false
+	}
+	_, ok = n.Underlying().(*types.Struct)
+	return n, ok
+}
+
+func (g *generator) run() ([]byte, error) {
+	for i := 0; i < len(g.queue); i++ {
+		if err := g.genStruct(g.queue[i]); err != nil {
+			return nil, err
+		}
+	}
+	body := g.buf.Bytes()
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by fractusgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", g.pkg.Name())
+	if bytes.Contains(body, []byte("binary.")) {
+		g.imports["encoding/binary"] = "binary"
+	}
+	if bytes.Contains(body, []byte("math.")) {
+		g.imports["math"] = "math"
+	}
+	if bytes.Contains(body, []byte("reflect.")) {
+		g.imports["reflect"] = "reflect"
+	}
+	// Standard library first, then everything else, as goimports would.
+	var std, other []string
+	for path := range g.imports {
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	for _, path := range std {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	out.WriteString("\n")
+	for _, path := range other {
+		fmt.Fprintf(&out, "%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.Write(body)
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// fields mirrors Fractus.buildPlan: exported fields plus embedded structs,
+// numbered by their tags and sorted by id.
+func (g *generator) fields(n *types.Named) ([]genField, error) {
+	st := n.Underlying().(*types.Struct)
+	var fields []genField
+	seen := make(map[int]string)
+	nextID := 1
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() && !(v.Embedded() && isStruct(v.Type())) {
+			continue
+		}
+		tag, err := tags.Parse(v.Name(), reflect.StructTag(st.Tag(i)))
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", n.Obj().Name(), v.Name(), err)
+		}
+		if tag.Skip {
+			continue
+		}
+		if err := g.check(v.Type()); err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", n.Obj().Name(), v.Name(), err)
+		}
+		f := genField{idx: i, name: v.Name(), typ: v.Type(), id: nextID, omitEmpty: tag.OmitEmpty}
+		if tag.ID != 0 {
+			f.id = tag.ID
+		}
+		if other, dup := seen[f.id]; dup {
+			return nil, fmt.Errorf("field %s.%s: %w: id %d already used by %s",
+				n.Obj().Name(), v.Name(), fractus.ErrInvalidTag, f.id, other)
+		}
+		seen[f.id] = v.Name()
+		nextID = f.id + 1
+		fields = append(fields, f)
+	}
+	slices.SortStableFunc(fields, func(a, b genField) int { return a.id - b.id })
+	return fields, nil
+}
+
+func isStruct(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// check rejects the types the reflective encoder rejects, plus structs the
+// generator cannot reach: anonymous ones and those of other packages.
+func (g *generator) check(t types.Type) error {
+	if isTime(t) {
+		return nil
+	}
+	if ok, err := g.custom(t); ok || err != nil {
+		return err
+	}
+	if n, ok := g.localStruct(t); ok {
+		g.enqueue(n)
+		return nil
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if fixedSize(u) > 0 || u.Kind() == types.String {
+			return nil
+		}
+	case *types.Pointer:
+		return g.check(u.Elem())
+	case *types.Slice:
+		return g.check(u.Elem())
+	case *types.Array:
+		return g.check(u.Elem())
+	case *types.Map:
+		if err := g.check(u.Key()); err != nil {
+			return err
+		}
+		return g.check(u.Elem())
+	case *types.Struct:
+		if _, named := types.Unalias(t).(*types.Named); named {
+			return fmt.Errorf("%w: struct %s is not defined in package %s",
+				fractus.ErrUnsupported, g.typeName(t), g.pkg.Name())
+		}
+		return fmt.Errorf("%w: anonymous %s", fractus.ErrUnsupported, g.typeName(t))
+	}
+	return fmt.Errorf("%w: %s", fractus.ErrUnsupported, g.typeName(t))
+}
+
+// fixedSize returns the wire size of a fixed-size basic type, or 0.
+func fixedSize(b *types.Basic) int {
+	switch b.Kind() {
+	case types.Bool, types.Int8, types.Uint8:
+		return 1
+	case types.Int16, types.Uint16:
+		return 2
+	case types.Int32, types.Uint32, types.Float32:
+		return 4
+	case types.Int64, types.Uint64, types.Float64, types.Int, types.Uint, types.Uintptr:
+		return 8
+	}
+	return 0
+}
+
+// minWireSize mirrors FieldInfo.minWireSize.
+func (g *generator) minWireSize(t types.Type) int64 {
+	if _, ok := g.localStruct(t); ok || g.isCustom(t) {
+		return 1
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if n := fixedSize(u); n > 0 {
+			return int64(n)
+		}
+	case *types.Array:
+		return u.Len() * g.minWireSize(u.Elem())
+	}
+	return 1
+}
+
+// isFixed reports whether t always has the same wire size: fixed-size
+// basics and arrays of them.
+func (g *generator) isFixed(t types.Type) bool {
+	if _, ok := g.localStruct(t); ok || g.isCustom(t) {
+		return false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return fixedSize(u) > 0
+	case *types.Array:
+		return g.isFixed(u.Elem())
+	}
+	return false
+}
+
+// isByte reports whether t is exactly byte, so []byte and [N]byte can be
+// copied in one go.
+func isByte(t types.Type) bool {
+	return types.Identical(t, types.Typ[types.Byte])
+}
+
+func (g *generator) genStruct(n *types.Named) error {
+	fields, err := g.fields(n)
+	if err != nil {
+		return err
+	}
+	name := g.typeName(n)
+	hasOmit := slices.ContainsFunc(fields, func(f genField) bool { return f.omitEmpty })
+	nb := (len(fields) + 7) / 8
+
+	g.p("\n// FractusGenerated marks the methods of %s as generated by fractusgen.\n", name)
+	g.p("func (%s) FractusGenerated() {}\n", name)
+
+	g.p("\n// MarshalFractus appends the Fractus encoding of x to dst.\n")
+	g.p("func (x %s) MarshalFractus(dst []byte) []byte {\n", name)
+	g.p("dst = fractus.AppendVarUint(dst, %d)\n", len(fields))
+	if hasOmit {
+		g.p("bm := len(dst)\n")
+		g.p("dst = append(dst, make([]byte, %d)...)\n", nb)
+	}
+	for i, f := range fields {
+		expr := "x." + f.name
+		g.p("// %s\n", f.name)
+		if hasOmit {
+			if f.omitEmpty {
+				g.p("if %s {\n", g.notEmpty(expr, f.typ))
+			} else {
+				g.p("{\n")
+			}
+			g.p("dst[%s] |= %d\n", offset("bm", i/8), 1<<(i%8))
+		}
+		g.encode("dst", expr, f.typ)
+		if hasOmit {
+			g.p("}\n")
+		}
+	}
+	g.p("return dst\n}\n")
+
+	g.p("\n// UnmarshalFractus decodes a Fractus payload into x.\n")
+	g.p("func (x *%s) UnmarshalFractus(b []byte) error {\n", name)
+	g.p("if p, err := x.decodeFractus(b, 0, 0); err != nil {\n")
+	g.p("return fractus.FieldError(p, -1, err)\n}\nreturn nil\n}\n")
+
+	g.p("\nfunc (x *%s) decodeFractus(b []byte, p, depth int) (int, error) {\n", name)
+	g.p("n, p, err := fractus.ReadVarUint(b, p)\n")
+	g.p("if err != nil {\nreturn p, err\n}\n")
+	g.p("if n != %d {\nreturn p, fractus.ErrFieldCount\n}\n", len(fields))
+	if hasOmit {
+		g.p("if len(b)-p < %d {\nreturn p, fractus.ErrLengthTooLarge\n}\n", nb)
+		g.p("bm := b[p : p+%d]\n", nb)
+		g.p("p += %d\n", nb)
+	}
+	for i, f := range fields {
+		g.field, g.depth = f.idx, 1
+		expr := "x." + f.name
+		g.p("// %s\n", f.name)
+		if hasOmit {
+			g.p("if bm[%d]&%d == 0 {\n%s = %s\n} else {\n", i/8, 1<<(i%8), expr, g.zero(f.typ))
+		}
+		g.decode(expr, f.typ)
+		if hasOmit {
+			g.p("}\n")
+		}
+	}
+	g.p("return p, nil\n}\n")
+	return nil
+}
+
+// notEmpty returns a boolean expression negating isEmptyValue.
+func (g *generator) notEmpty(expr string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.String:
+			return "len(" + expr + ") != 0"
+		case u.Kind() == types.Bool:
+			return expr
+		}
+		return expr + " != 0"
+	case *types.Slice, *types.Map:
+		return "len(" + expr + ") != 0"
+	case *types.Pointer:
+		return expr + " != nil"
+	}
+	if types.Comparable(t) {
+		// parenthesized, as a composite literal cannot appear bare in an
+		// if condition
+		return expr + " != (" + g.zero(t) + ")"
+	}
+	return "!reflect.ValueOf(" + expr + ").IsZero()"
+}
+
+// offset formats base+n, or just base for n == 0.
+func offset(base string, n int) string {
+	if n == 0 {
+		return base
+	}
+	return fmt.Sprintf("%s+%d", base, n)
+}
+
+// operand parenthesizes a dereference so it can be indexed or selected.
+func operand(expr string) string {
+	if strings.HasPrefix(expr, "*") {
+		return "(" + expr + ")"
+	}
+	return expr
+}
+
+// address returns a pointer expression to the addressable expr.
+func address(expr string) string {
+	if strings.HasPrefix(expr, "*") {
+		return expr[1:]
+	}
+	return "&" + expr
+}
+
+// receiver returns expr for calling a generated method on it; a single
+// dereference is left to Go's automatic pointer indirection.
+func receiver(expr string) string {
+	return operand(strings.TrimPrefix(expr, "*"))
+}
+
+// zero returns the zero value literal of t.
+func (g *generator) zero(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Kind() == types.String:
+			return `""`
+		case u.Kind() == types.Bool:
+			return "false"
+		}
+		return "0"
+	case *types.Struct, *types.Array:
+		return g.typeName(t) + "{}"
+	}
+	return "nil"
+}
+
+// encode emits statements appending expr, of type t, to the slice dst.
+func (g *generator) encode(dst, expr string, t types.Type) {
+	if isTime(t) {
+		g.p("%s = fractus.AppendTime(%s, %s)\n", dst, dst, expr)
+		return
+	}
+	if _, ok := g.localStruct(t); ok || g.isCustom(t) {
+		s := g.name("start")
+		g.p("%s := len(%s)\n", s, dst)
+		g.p("%s = %s.MarshalFractus(%s)\n", dst, receiver(expr), dst)
+		g.p("%s = fractus.InsertVarUint(%s, %s, uint64(len(%s)-%s))\n", dst, dst, s, dst, s)
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.Bool:
+			g.p("if %s {\n%s = append(%s, 1)\n} else {\n%s = append(%s, 0)\n}\n", expr, dst, dst, dst, dst)
+		case types.Int8, types.Uint8:
+			g.p("%s = append(%s, byte(%s))\n", dst, dst, expr)
+		case types.Int16, types.Uint16:
+			g.p("%s = binary.LittleEndian.AppendUint16(%s, uint16(%s))\n", dst, dst, expr)
+		case types.Int32, types.Uint32:
+			g.p("%s = binary.LittleEndian.AppendUint32(%s, uint32(%s))\n", dst, dst, expr)
+		case types.Float32:
+			g.p("%s = binary.LittleEndian.AppendUint32(%s, math.Float32bits(float32(%s)))\n", dst, dst, expr)
+		case types.Float64:
+			g.p("%s = binary.LittleEndian.AppendUint64(%s, math.Float64bits(float64(%s)))\n", dst, dst, expr)
+		case types.String:
+			g.p("%s = fractus.AppendVarUint(%s, uint64(len(%s)))\n", dst, dst, expr)
+			g.p("%s = append(%s, %s...)\n", dst, dst, expr)
+		default: // 64-bit and platform-sized integers
+			g.p("%s = binary.LittleEndian.AppendUint64(%s, uint64(%s))\n", dst, dst, expr)
+		}
+	case *types.Pointer:
+		g.p("if %s == nil {\n%s = append(%s, 0)\n} else {\n", expr, dst, dst)
+		g.p("%s = append(%s, 1)\n", dst, dst)
+		g.encode(dst, "*"+expr, u.Elem())
+		g.p("}\n")
+	case *types.Slice:
+		g.p("%s = fractus.AppendVarUint(%s, uint64(len(%s)))\n", dst, dst, expr)
+		if isByte(u.Elem()) {
+			g.p("%s = append(%s, %s...)\n", dst, dst, expr)
+			return
+		}
+		v := g.name("v")
+		g.p("for _, %s := range %s {\n", v, expr)
+		g.encode(dst, v, u.Elem())
+		g.p("}\n")
+	case *types.Array:
+		if isByte(u.Elem()) {
+			g.p("%s = append(%s, %s[:]...)\n", dst, dst, operand(expr))
+			return
+		}
+		i := g.name("i")
+		g.p("for %s := range %s {\n", i, expr)
+		g.encode(dst, operand(expr)+"["+i+"]", u.Elem())
+		g.p("}\n")
+	case *types.Map:
+		buf, entries, k, v, e := g.name("buf"), g.name("entries"), g.name("k"), g.name("v"), g.name("e")
+		g.p("%s = fractus.AppendVarUint(%s, uint64(len(%s)))\n", dst, dst, expr)
+		g.p("if len(%s) > 0 {\n", expr)
+		g.p("var %s []byte\n", buf)
+		g.p("%s := make([]fractus.MapEntry, 0, len(%s))\n", entries, expr)
+		g.p("for %s, %s := range %s {\n", k, v, expr)
+		g.p("%s := fractus.MapEntry{Start: len(%s)}\n", e, buf)
+		g.encode(buf, k, u.Key())
+		g.p("%s.KeyEnd = len(%s)\n", e, buf)
+		g.encode(buf, v, u.Elem())
+		g.p("%s.End = len(%s)\n", e, buf)
+		g.p("%s = append(%s, %s)\n}\n", entries, entries, e)
+		g.p("%s = fractus.AppendMapEntries(%s, %s, %s)\n}\n", dst, dst, buf, entries)
+	}
+}
+
+// fail emits a return of err wrapped for the field being decoded.
+func (g *generator) fail(err string) {
+	g.p("return p, fractus.FieldError(p, %d, %s)\n", g.field, err)
+}
+
+// decode emits statements reading a value of type t at b[p] into the
+// addressable expression target and advancing p.
+func (g *generator) decode(target string, t types.Type) {
+	if isTime(t) {
+		n, q, v := g.name("n"), g.name("q"), g.name("t")
+		g.readCount(n, q, 1)
+		g.p("%s, err := fractus.ReadTime(b[%s : %s+%s])\n", v, q, q, n)
+		g.p("if err != nil {\nreturn %s, fractus.FieldError(%s, %d, err)\n}\n", q, q, g.field)
+		g.p("%s = %s\n", target, v)
+		g.p("p = %s + %s\n", q, n)
+		return
+	}
+	if g.isCustom(t) {
+		n, q := g.name("n"), g.name("q")
+		g.readCount(n, q, 1)
+		g.p("if err := fractus.UnmarshalAt(%s, b, %s, %s+%s); err != nil {\n", address(target), q, q, n)
+		g.p("return %s, fractus.FieldError(%s, %d, err)\n}\n", q, q, g.field)
+		g.p("p = %s + %s\n", q, n)
+		return
+	}
+	if _, ok := g.localStruct(t); ok {
+		n, q, at := g.name("n"), g.name("q"), g.name("at")
+		d := fmt.Sprintf("depth+%d", g.depth)
+		g.p("if err := fractus.CheckDepth(%s); err != nil {\n", d)
+		g.fail("err")
+		g.p("}\n")
+		g.readCount(n, q, 1)
+		g.p("if %s, err := %s.decodeFractus(b[:%s+%s], %s, %s); err != nil {\n", at, receiver(target), q, n, q, d)
+		g.p("return %s, fractus.FieldError(%s, %d, err)\n}\n", at, at, g.field)
+		g.p("p = %s + %s\n", q, n)
+		return
+	}
+	typ := g.typeName(t)
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Kind() == types.String {
+			n, q := g.name("n"), g.name("q")
+			g.readCount(n, q, 1)
+			g.p("%s = %s(b[%s : %s+%s])\n", target, typ, q, q, n)
+			g.p("p = %s + %s\n", q, n)
+			return
+		}
+		size := fixedSize(u)
+		g.p("if len(b)-p < %d {\n", size)
+		g.fail("fractus.ErrTruncated")
+		g.p("}\n")
+		switch u.Kind() {
+		case types.Bool:
+			g.p("%s = %s(b[p] != 0)\n", target, typ)
+		case types.Int8:
+			g.p("%s = %s(int8(b[p]))\n", target, typ)
+		case types.Uint8:
+			g.p("%s = %s(b[p])\n", target, typ)
+		case types.Int16:
+			g.p("%s = %s(int16(binary.LittleEndian.Uint16(b[p:])))\n", target, typ)
+		case types.Uint16:
+			g.p("%s = %s(binary.LittleEndian.Uint16(b[p:]))\n", target, typ)
+		case types.Int32:
+			g.p("%s = %s(int32(binary.LittleEndian.Uint32(b[p:])))\n", target, typ)
+		case types.Uint32:
+			g.p("%s = %s(binary.LittleEndian.Uint32(b[p:]))\n", target, typ)
+		case types.Float32:
+			g.p("%s = %s(math.Float32frombits(binary.LittleEndian.Uint32(b[p:])))\n", target, typ)
+		case types.Int64:
+			g.p("%s = %s(int64(binary.LittleEndian.Uint64(b[p:])))\n", target, typ)
+		case types.Uint64:
+			g.p("%s = %s(binary.LittleEndian.Uint64(b[p:]))\n", target, typ)
+		case types.Float64:
+			g.p("%s = %s(math.Float64frombits(binary.LittleEndian.Uint64(b[p:])))\n", target, typ)
+		case types.Int:
+			v := g.name("v")
+			g.p("if %s := int64(binary.LittleEndian.Uint64(b[p:])); int64(int(%s)) != %s {\n", v, v, v)
+			g.fail("fractus.ErrIntOverflow")
+			g.p("} else {\n%s = %s(%s)\n}\n", target, typ, v)
+		default: // uint, uintptr
+			v := g.name("v")
+			g.p("if %s := binary.LittleEndian.Uint64(b[p:]); uint64(%s(%s)) != %s {\n", v, u.Name(), v, v)
+			g.fail("fractus.ErrIntOverflow")
+			g.p("} else {\n%s = %s(%s)\n}\n", target, typ, v)
+		}
+		g.p("p += %d\n", size)
+	case *types.Pointer:
+		g.p("if p >= len(b) {\n")
+		g.fail("fractus.ErrTruncated")
+		g.p("}\n")
+		g.p("switch b[p] {\ncase 0:\n%s = nil\np++\ncase 1:\np++\n", target)
+		g.p("if %s == nil {\n%s = new(%s)\n}\n", target, target, g.typeName(u.Elem()))
+		g.nested(func() { g.decode("*"+target, u.Elem()) })
+		g.p("default:\n")
+		g.fail("fractus.ErrInvalidPresence")
+		g.p("}\n")
+	case *types.Slice:
+		n, q, s := g.name("n"), g.name("q"), g.name("s")
+		g.readCount(n, q, g.minWireSize(u.Elem()))
+		g.p("p = %s\n", q)
+		g.p("%s := make(%s, %s)\n", s, typ, n)
+		if isByte(u.Elem()) {
+			g.p("copy(%s, b[p:])\n", s)
+			g.p("p += %s\n", n)
+		} else {
+			i := g.name("i")
+			g.p("for %s := range %s {\n", i, s)
+			g.nested(func() { g.decode(s+"["+i+"]", u.Elem()) })
+			g.p("}\n")
+		}
+		g.p("%s = %s\n", target, s)
+	case *types.Array:
+		if isByte(u.Elem()) {
+			g.p("if len(b)-p < %d {\n", u.Len())
+			g.fail("fractus.ErrTruncated")
+			g.p("}\n")
+			g.p("copy(%s[:], b[p:])\n", operand(target))
+			g.p("p += %d\n", u.Len())
+			return
+		}
+		if g.isFixed(t) {
+			g.p("if len(b)-p < %d {\n", u.Len()*g.minWireSize(u.Elem()))
+			g.fail("fractus.ErrTruncated")
+			g.p("}\n")
+		}
+		i := g.name("i")
+		g.p("for %s := range %s {\n", i, target)
+		g.nested(func() { g.decode(operand(target)+"["+i+"]", u.Elem()) })
+		g.p("}\n")
+	case *types.Map:
+		n, q, m, i, k, v := g.name("n"), g.name("q"), g.name("m"), g.name("i"), g.name("k"), g.name("v")
+		g.readCount(n, q, g.minWireSize(u.Key())+g.minWireSize(u.Elem()))
+		g.p("p = %s\n", q)
+		g.p("%s := make(%s, %s)\n", m, typ, n)
+		g.p("for %s := 0; %s < %s; %s++ {\n", i, i, n, i)
+		g.p("var %s %s\n", k, g.typeName(u.Key()))
+		g.nested(func() { g.decode(k, u.Key()) })
+		g.p("var %s %s\n", v, g.typeName(u.Elem()))
+		g.nested(func() { g.decode(v, u.Elem()) })
+		g.p("%s[%s] = %s\n}\n", m, k, v)
+		g.p("%s = %s\n", target, m)
+	}
+}
+
+// nested runs emit for a value one level deeper than the current one, as
+// decodeValue counts depth.
+func (g *generator) nested(emit func()) {
+	g.depth++
+	emit()
+	g.depth--
+}
+
+// readCount emits a bounds-checked length read into n, leaving the offset
+// after the length in q.
+func (g *generator) readCount(n, q string, width int64) {
+	g.p("%s, %s, err := fractus.ReadCount(b, p, %d)\n", n, q, width)
+	g.p("if err != nil {\n")
+	g.fail("err")
+	g.p("}\n")
+}
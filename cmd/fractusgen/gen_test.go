@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rawbytedev/fractus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The checked-in output for internal/gentest must match what the generator
+// produces today; run `go generate ./internal/gentest` after changing it.
+func TestGenerate_UpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..", "internal", "gentest")
+	want, err := os.ReadFile(filepath.Join(dir, "fractus_gen.go"))
+	require.NoError(t, err)
+	got, err := generate(dir, "fractus_gen.go", nil)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := []struct {
+		name, src string
+		types     []string
+		want      error
+	}{
+		{"channel", "type T struct{ C chan int }", []string{"T"}, fractus.ErrUnsupported},
+		{"anonymous struct", "type T struct{ S struct{ A int } }", []string{"T"}, fractus.ErrUnsupported},
+		{"duplicate id", "type T struct{ A int `fractus:\"id=1\"`; B int `fractus:\"id=1\"` }", []string{"T"}, fractus.ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := "package p\n\n" + tt.src + "\n"
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644))
+			_, err := generate(dir, "fractus_gen.go", tt.types)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "p.go"), []byte("package p\n\ntype T struct{}\n"), 0o644))
+	_, err := generate(dir, "fractus_gen.go", nil)
+	assert.ErrorContains(t, err, "no types to generate")
+	_, err = generate(dir, "fractus_gen.go", []string{"Missing"})
+	assert.ErrorContains(t, err, "not found")
+}
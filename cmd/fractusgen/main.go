@@ -0,0 +1,150 @@
+// Command fractusgen generates reflection-free MarshalFractus and
+// UnmarshalFractus methods for Go structs.
+//
+// Structs are selected with the -type flag or by a //fractus:generate line
+// in their doc comment. Struct types from the same package that they
+// reference are generated as well. The methods produce exactly the bytes of
+// the reflective compact encoding, and Fractus.Encode and Fractus.Decode
+// pick them up automatically.
+//
+// Typical use is a go:generate directive in the package:
+//
+//	//go:generate go run github.com/rawbytedev/fractus/cmd/fractusgen
+//
+//	//fractus:generate
+//	type Order struct { ... }
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// annotation marks a struct for generation when -type is not given.
+const annotation = "//fractus:generate"
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of struct names; defaults to annotated structs")
+	output := flag.String("output", "fractus_gen.go", "output file name, relative to the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: fractusgen [-type T1,T2] [-output file] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+	src, err := generate(dir, *output, names)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fractusgen: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "fractusgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// generate type-checks the package in dir, skipping a previous output file,
+// and returns the formatted source of the generated methods.
+func generate(dir, output string, names []string) ([]byte, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		if name == output {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(names) == 0 {
+		names = annotated(files)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no types to generate: use -type or a %s comment", annotation)
+	}
+
+	// Type errors are tolerated: code in the package may already call the
+	// methods that are about to be generated.
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, fset, files, nil)
+
+	g := newGenerator(pkg)
+	for _, name := range names {
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("type %s not found in %s", name, dir)
+		}
+		named, ok := obj.Type().(*types.Named)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a defined type", name)
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("%s is not a struct", name)
+		}
+		g.enqueue(named)
+	}
+	return g.run()
+}
+
+// annotated returns the names of the struct types whose doc comment
+// contains the generate annotation.
+func annotated(files []*ast.File) []string {
+	var names []string
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc
+				}
+				if _, ok := ts.Type.(*ast.StructType); ok && hasAnnotation(doc) {
+					names = append(names, ts.Name.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func hasAnnotation(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package fractus
+
+import (
+	"reflect"
+
+	"github.com/rawbytedev/fractus/plugins"
+)
+
+// codec is a pair of functions registered for one type.
+type codec struct {
+	encode plugins.EncodeFunc
+	decode plugins.DecodeFunc
+}
+
+// RegisterCodec makes f encode values of type t with enc and decode them
+// with dec, for types that cannot implement Marshaler themselves such as
+// netip.Addr or big.Int; see the plugins package for ready-made codecs.
+// Registered codecs take precedence over Marshaler methods, the built-in
+// time.Time encoding and the kind-based encoding, and apply only to f.
+//
+// On the wire a registered type looks like a Marshaler: a VarInt byte
+// length followed by whatever enc appended. Generated methods are not used
+// by an instance with registered codecs, since they cannot see them.
+//
+// RegisterCodec must be called before f is used; it is not safe to call
+// concurrently with Encode or Decode.
+func (f *Fractus) RegisterCodec(t reflect.Type, enc plugins.EncodeFunc, dec plugins.DecodeFunc) {
+	if t == nil || enc == nil || dec == nil {
+		panic("fractus: RegisterCodec with nil type or function")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.codecs == nil {
+		f.codecs = make(map[reflect.Type]*codec)
+	}
+	f.codecs[t] = &codec{encode: enc, decode: dec}
+	// cached plans may embed the previous classification of t
+	clear(f.plan)
+	f.readers = nil
+	f.tops = nil
+	f.fingerprints = nil
+}
+
+// codecFor returns the codec f uses for t: a registered one, else a
+// built-in one, else nil.
+func (f *Fractus) codecFor(t reflect.Type) *codec {
+	if c, ok := f.codecs[t]; ok {
+		return c
+	}
+	if t == timeType {
+		return &codec{encode: f.encodeTime, decode: f.decodeTime}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package fractus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrVersion is returned for enveloped payloads written in a format version
+// this package cannot read.
+var ErrVersion = errors.New("unsupported format version")
+
+// FormatVersion is the format version written in envelopes.
+const FormatVersion = 1
+
+// envelopeMagic starts enveloped payloads. Like checksumMarker it begins
+// with a varint that writeVarUint never produces (0 in three bytes), so a
+// plain or checksummed payload cannot start with it.
+const envelopeMagic = "\x80\x80\x00FR"
+
+// envelopeLen is the size of the envelope header: the magic, the version
+// and the flags.
+const envelopeLen = len(envelopeMagic) + 2
+
+// Flags records in an envelope how the payload inside was written.
+type Flags uint8
+
+const (
+	// FlagChecksum marks a CRC-32C trailer; see SafeOptions.Checksum.
+	FlagChecksum Flags = 1 << iota
+	// FlagCompressed marks a compressed body. Nothing in this package
+	// writes it yet, and Decode rejects such payloads with ErrUnsupported.
+	FlagCompressed
+	// FlagSelfDescribing marks a body written with
+	// SafeOptions.SelfDescribing.
+	FlagSelfDescribing
+	// FlagOffsetTable marks an offset table; see SafeOptions.OffsetTable.
+	FlagOffsetTable
+	// FlagFingerprint marks a fingerprint ahead of the body; see
+	// SafeOptions.Fingerprint. Fingerprints carry a marker of their own,
+	// so readers find them without it.
+	FlagFingerprint
+
+	knownFlags = FlagChecksum | FlagCompressed | FlagSelfDescribing | FlagOffsetTable | FlagFingerprint
+)
+
+// Envelope is the header of an enveloped payload.
+type Envelope struct {
+	Version uint8
+	Flags   Flags
+}
+
+// Sniff reports whether b starts with an envelope and returns its header.
+// It only looks at the header: the version and flags are returned as
+// found, and the rest of b is not checked.
+func (f *Fractus) Sniff(b []byte) (Envelope, bool) {
+	if len(b) < envelopeLen || !bytes.HasPrefix(b, []byte(envelopeMagic)) {
+		return Envelope{}, false
+	}
+	return Envelope{Version: b[len(envelopeMagic)], Flags: Flags(b[len(envelopeMagic)+1])}, true
+}
+
+// flags returns the Flags describing what f writes for a type that is
+// opaque or not.
+func (f *Fractus) flags(opaque bool) Flags {
+	var flags Flags
+	if f.Opts.Checksum {
+		flags |= FlagChecksum
+	}
+	if f.Opts.SelfDescribing {
+		flags |= FlagSelfDescribing
+	} else if f.Opts.OffsetTable {
+		flags |= FlagOffsetTable
+	}
+	if f.Opts.Fingerprint && !opaque {
+		flags |= FlagFingerprint
+	}
+	return flags
+}
+
+// frameOverhead returns the bytes SafeOptions.Envelope and
+// SafeOptions.Checksum add to a payload.
+func (f *Fractus) frameOverhead() int {
+	n := 0
+	if f.Opts.Envelope {
+		n = envelopeLen
+	} else if f.Opts.Checksum {
+		n = len(checksumMarker)
+	}
+	if f.Opts.Checksum {
+		n += checksumLen
+	}
+	return n
+}
+
+// startFrame appends what a payload starts with before its body: the
+// envelope header, or the checksum marker for checksummed payloads without
+// an envelope. The frame is finished by appendChecksum.
+func (f *Fractus) startFrame(dst []byte, opaque bool) []byte {
+	if f.Opts.Envelope {
+		return append(append(dst, envelopeMagic...), FormatVersion, byte(f.flags(opaque)))
+	}
+	if f.Opts.Checksum {
+		return append(dst, checksumMarker...)
+	}
+	return dst
+}
+
+// openFrame strips the envelope or checksum of in, verifying the checksum,
+// and returns the body inside, its offset in `in`, and the Fractus to read
+// it with: f itself, or one set up for the format the envelope records.
+// Plain payloads are returned as they are, so any Fractus reads all kinds.
+// The payload of an opaque type may start with any bytes, so for those
+// frames are only looked for when f writes them.
+func (f *Fractus) openFrame(in []byte, opaque bool) ([]byte, int, *Fractus, error) {
+	if opaque && !f.Opts.Envelope && !f.Opts.Checksum {
+		return in, 0, f, nil
+	}
+	if env, ok := f.Sniff(in); ok {
+		switch env.Version {
+		case FormatVersion:
+			if env.Flags&^knownFlags != 0 {
+				return nil, 0, nil, decodeErr(envelopeLen-1, -1, fmt.Errorf("%w: envelope flags %#x", ErrUnsupported, env.Flags))
+			}
+			if env.Flags&FlagCompressed != 0 {
+				return nil, 0, nil, decodeErr(envelopeLen-1, -1, fmt.Errorf("%w: compressed payload", ErrUnsupported))
+			}
+		default:
+			return nil, 0, nil, decodeErr(len(envelopeMagic), -1, fmt.Errorf("%w: %d", ErrVersion, env.Version))
+		}
+		body := in[envelopeLen:]
+		if env.Flags&FlagChecksum != 0 {
+			var err error
+			if body, err = verifyChecksum(in, envelopeLen); err != nil {
+				return nil, 0, nil, err
+			}
+		}
+		return body, envelopeLen, f.reader(env.Flags), nil
+	}
+	if bytes.HasPrefix(in, []byte(checksumMarker)) {
+		body, err := verifyChecksum(in, len(checksumMarker))
+		return body, len(checksumMarker), f, err
+	}
+	return in, 0, f, nil
+}
+
+// reader returns a Fractus with f's options and registered codecs that
+// reads payloads written with flags. Instances other than f are created on
+// first use and kept until the next RegisterCodec.
+func (f *Fractus) reader(flags Flags) *Fractus {
+	opts := f.Opts
+	opts.SelfDescribing = flags&FlagSelfDescribing != 0
+	// tagged payloads have no offset table to read
+	if !opts.SelfDescribing {
+		opts.OffsetTable = flags&FlagOffsetTable != 0
+	}
+	if opts == f.Opts {
+		return f
+	}
+	f.mu.RLock()
+	r, ok := f.readers[opts]
+	f.mu.RUnlock()
+	if ok {
+		return r
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r, ok := f.readers[opts]; ok {
+		return r
+	}
+	if f.readers == nil {
+		f.readers = make(map[SafeOptions]*Fractus)
+	}
+	r = NewFractus(opts)
+	r.codecs = f.codecs
+	f.readers[opts] = r
+	return r
+}
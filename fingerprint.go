@@ -0,0 +1,156 @@
+package fractus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"reflect"
+)
+
+// ErrSchemaMismatch is returned when a payload written with
+// SafeOptions.Fingerprint was encoded from a struct of another shape.
+var ErrSchemaMismatch = errors.New("schema mismatch")
+
+// fingerprintMarker starts a fingerprint. Like checksumMarker it reads as a
+// varint writeVarUint never produces (1 in two bytes), so the fingerprint
+// cannot be mistaken for a frame or for the start of a struct encoding.
+const fingerprintMarker = "\x81\x00"
+
+// fingerprintLen is the size of the marked fingerprint written ahead of
+// the body.
+const fingerprintLen = len(fingerprintMarker) + 8
+
+// Fingerprint returns a stable 64-bit hash of the layout of struct type t:
+// the wire name, id, omitempty option, kind and position of every field,
+// recursively through nested structs, elements and map keys. Types that
+// encode themselves contribute their name only. It depends on nothing but
+// the plan, so it is the same across processes and builds, and changes
+// whenever a field is added, removed, renamed, renumbered, reordered,
+// retyped or tagged omitempty. Recursive types hash a
+// back reference where they repeat, so a defined copy of one (type B A)
+// gets a fingerprint of its own.
+func (f *Fractus) Fingerprint(t reflect.Type) (uint64, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return 0, ErrNotStruct
+	}
+	f.mu.RLock()
+	sum, ok := f.fingerprints[t]
+	f.mu.RUnlock()
+	if ok {
+		return sum, nil
+	}
+	tl, err := f.top(t)
+	if err != nil {
+		return 0, err
+	}
+	if tl.opaque {
+		return 0, fmt.Errorf("%w: %s encodes itself and has no fingerprint", ErrUnsupported, t)
+	}
+	h := fnv.New64a()
+	hashPlan(h, tl.plan, map[*FieldPlan]int{})
+	sum = h.Sum64()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fingerprints == nil {
+		f.fingerprints = make(map[reflect.Type]uint64)
+	}
+	f.fingerprints[t] = sum
+	return sum, nil
+}
+
+// hashPlan feeds the fields of plan to h. seen numbers the plans entered so
+// far, so that recursive types hash a back reference instead of looping.
+func hashPlan(h hash.Hash64, plan *FieldPlan, seen map[*FieldPlan]int) {
+	if n, ok := seen[plan]; ok {
+		hashString(h, "^")
+		h.Write(binary.AppendUvarint(nil, uint64(n)))
+		return
+	}
+	seen[plan] = len(seen)
+	hashString(h, "{")
+	h.Write(binary.AppendUvarint(nil, uint64(len(plan.fields))))
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		hashString(h, field.name)
+		// ids match fields in self-describing mode, and omitempty adds the
+		// presence bitmap, so both are part of the layout
+		h.Write(binary.AppendUvarint(nil, uint64(field.id)))
+		if field.omitEmpty {
+			hashString(h, "omitempty")
+		}
+		hashInfo(h, field, seen)
+	}
+	hashString(h, "}")
+}
+
+// hashInfo feeds the shape of a single value to h.
+func hashInfo(h hash.Hash64, info *FieldInfo, seen map[*FieldPlan]int) {
+	if info.custom && !info.generated {
+		hashString(h, "custom")
+		hashString(h, info.typ.Name())
+		return
+	}
+	hashString(h, info.kind.String())
+	switch info.kind {
+	case reflect.Array:
+		h.Write(binary.AppendUvarint(nil, uint64(info.typ.Len())))
+		hashInfo(h, info.elem, seen)
+	case reflect.Slice, reflect.Ptr:
+		hashInfo(h, info.elem, seen)
+	case reflect.Map:
+		hashInfo(h, info.key, seen)
+		hashInfo(h, info.elem, seen)
+	case reflect.Struct:
+		hashPlan(h, info.sub, seen)
+	}
+}
+
+// hashString feeds s to h behind its length, so that adjacent strings
+// cannot run into each other.
+func hashString(h hash.Hash64, s string) {
+	h.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	h.Write([]byte(s))
+}
+
+// appendFingerprint appends the fingerprint of t when
+// SafeOptions.Fingerprint is set.
+func (f *Fractus) appendFingerprint(dst []byte, t reflect.Type) ([]byte, error) {
+	if !f.Opts.Fingerprint {
+		return dst, nil
+	}
+	sum, err := f.Fingerprint(t)
+	if err != nil {
+		return nil, err
+	}
+	return binary.LittleEndian.AppendUint64(append(dst, fingerprintMarker...), sum), nil
+}
+
+// readFingerprint checks the fingerprint at the start of in, if it has
+// one, against t's and returns the position after it. Payloads without a
+// fingerprint are rejected when SafeOptions.Fingerprint is set.
+func (f *Fractus) readFingerprint(in []byte, t reflect.Type) (int, error) {
+	if !bytes.HasPrefix(in, []byte(fingerprintMarker)) {
+		if f.Opts.Fingerprint {
+			return 0, decodeErr(0, -1, fmt.Errorf("%w: payload has no fingerprint", ErrSchemaMismatch))
+		}
+		return 0, nil
+	}
+	if len(in) < fingerprintLen {
+		return 0, decodeErr(len(in), -1, ErrTruncated)
+	}
+	want, err := f.Fingerprint(t)
+	if err != nil {
+		return 0, err
+	}
+	if got := binary.LittleEndian.Uint64(in[len(fingerprintMarker):]); got != want {
+		return 0, decodeErr(len(fingerprintMarker), -1, fmt.Errorf("%w: payload %016x, %s %016x", ErrSchemaMismatch, got, t, want))
+	}
+	return fingerprintLen, nil
+}
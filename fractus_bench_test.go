@@ -154,3 +154,89 @@ func BenchmarkDecode_WithSafeDecoder(b *testing.B) {
 		sd.Decode(data, &out)
 	}
 }
+
+func BenchmarkCodec_AppendMarshal(b *testing.B) {
+	type NewStruct struct {
+		Val      []string
+		Mod      []int8
+		Integers []int16
+		Float3   []float32
+		Float6   []float64
+	}
+	Val := []string{"azerty", "hello", "world", "random"}
+	z := NewStruct{Val: Val,
+		Mod: []int8{12, 10, 13, 1}, Integers: []int16{100, 250, 300},
+		Float3: []float32{12.13, 16.23, 75.1}, Float6: []float64{100.5, 165.63, 153.5}}
+	c, _ := NewCodec[NewStruct](SafeOptions{})
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = c.AppendMarshal(buf[:0], &z)
+	}
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	type ZeroAllocs struct {
+		Int int8
+		Str string
+	}
+	z := &ZeroAllocs{Int: 1, Str: "frame"}
+	f := NewFractus(SafeOptions{})
+	frame := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame, _ = f.AppendEncode(frame[:0], z)
+	}
+}
+
+func benchmarkViewLastField(b *testing.B, opts SafeOptions) {
+	type NewStruct struct {
+		Val      []string
+		Mod      []int8
+		Integers []int16
+		Float3   []float32
+		Float6   []float64
+		Last     int64
+	}
+	Val := []string{"azerty", "hello", "world", "random"}
+	z := NewStruct{Val: Val,
+		Mod: []int8{12, 10, 13, 1}, Integers: []int16{100, 250, 300},
+		Float3: []float32{12.13, 16.23, 75.1}, Float6: []float64{100.5, 165.63, 153.5}, Last: 7}
+	c, _ := NewCodec[NewStruct](opts)
+	data, _ := c.Marshal(&z)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v, _ := c.View(data)
+		_, _ = v.Int64(5)
+	}
+}
+
+func BenchmarkView_LastField(b *testing.B) {
+	benchmarkViewLastField(b, SafeOptions{})
+}
+
+func BenchmarkView_LastField_OffsetTable(b *testing.B) {
+	benchmarkViewLastField(b, SafeOptions{OffsetTable: true})
+}
+
+func BenchmarkDecodeFields_OneOfSix(b *testing.B) {
+	type NewStruct struct {
+		Val      []string
+		Mod      []int8
+		Integers []int16
+		Float3   []float32
+		Float6   []float64
+		Last     int64
+	}
+	Val := []string{"azerty", "hello", "world", "random"}
+	z := NewStruct{Val: Val,
+		Mod: []int8{12, 10, 13, 1}, Integers: []int16{100, 250, 300},
+		Float3: []float32{12.13, 16.23, 75.1}, Float6: []float64{100.5, 165.63, 153.5}, Last: 7}
+	f := NewFractus(SafeOptions{})
+	data, _ := f.Encode(z)
+	var out NewStruct
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = f.DecodeFields(data, &out, "Last")
+	}
+}
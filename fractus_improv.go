@@ -3,22 +3,123 @@ package fractus
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"math"
 	"reflect"
+	"slices"
 	"sync"
 	"unsafe"
+
+	"github.com/rawbytedev/fractus/internal/tags"
 )
 
 var (
 	ErrNotStruct    = errors.New("expected struct")
 	ErrNotStructPtr = errors.New("expected pointer to struct")
 	ErrUnsupported  = errors.New("unsupported type")
+	// ErrTruncated is returned when the input ends before a value is complete.
+	ErrTruncated = errors.New("truncated input")
+	// ErrVarintOverflow is returned for varints that do not fit in 64 bits.
+	ErrVarintOverflow = errors.New("varint overflows 64 bits")
+	// ErrVarintNonCanonical is returned by generated decoders for varints
+	// written in more bytes than needed, which the encoder never does.
+	ErrVarintNonCanonical = errors.New("varint is not in its shortest form")
+	// ErrLengthTooLarge is returned when a length or count prefix claims more
+	// data than the remaining input holds.
+	ErrLengthTooLarge = errors.New("length exceeds remaining input")
+	// ErrInvalidPresence is returned when a pointer presence marker is
+	// neither 0 (nil) nor 1 (present).
+	ErrInvalidPresence = errors.New("invalid presence marker")
+	// ErrIntOverflow is returned when a decoded int, uint or uintptr does
+	// not fit the platform width of the destination.
+	ErrIntOverflow = errors.New("integer overflows destination type")
+	// ErrFieldCount is returned when a payload's field count differs from
+	// the destination struct and SafeOptions.Compatible is not set.
+	ErrFieldCount = errors.New("field count does not match struct")
 )
 
+// DecodeError reports where decoding failed. Offset is the byte offset into
+// the input passed to Decode and Field is the struct field index being
+// decoded, or -1 when the failure happened while reading the header.
+// The underlying cause (e.g. ErrTruncated) is available through errors.Is.
+type DecodeError struct {
+	Offset int
+	Field  int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field < 0 {
+		return fmt.Sprintf("decode header at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("decode field %d at offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// decodeErr wraps err with the offset and field index it occurred at.
+func decodeErr(offset, field int, err error) error {
+	return &DecodeError{Offset: offset, Field: field, Err: err}
+}
+
+// fieldErr is decodeErr for errors bubbling out of a field: errors already
+// located by a nested struct keep their innermost offset and field.
+func fieldErr(offset, field int, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return decodeErr(offset, field, err)
+}
+
 type SafeOptions struct {
 	UnsafeStrings    bool
 	UnsafePrimitives bool
 	CheckAlignment   bool
+	// Compatible lets Decode accept payloads written for an older or newer
+	// version of a struct: unknown trailing fields are skipped and fields
+	// missing from the payload are set to their zero value. Without it a
+	// field count that differs from the struct is rejected with
+	// ErrFieldCount.
+	Compatible bool
+	// SelfDescribing prefixes every field with a tag holding its field id
+	// and wire kind (see WireKind). Decoding then matches fields by id, so
+	// it tolerates reordered, added and removed fields, and payloads can be
+	// inspected without the Go type via ReadFields. Both sides must agree
+	// on this option.
+	SelfDescribing bool
+	// UTCTimes normalizes time.Time values to UTC: no zone offset is
+	// written and decoded times are always in UTC.
+	UTCTimes bool
+	// Limits bounds what Decode accepts from untrusted payloads.
+	Limits DecodeLimits
+	// OffsetTable appends a table of field offsets to top-level structs in
+	// compact mode, so a View reaches any field without walking the ones
+	// before it. Decode ignores the table; NewView needs this option to
+	// find it.
+	OffsetTable bool
+	// Checksum ends every payload with a CRC-32C trailer, which Decode
+	// verifies before reading any field. The trailer is announced by a
+	// marker, or by the envelope flags with Envelope. Payloads without it
+	// are still decoded as they are, so a reader with Checksum set accepts
+	// both kinds.
+	Checksum bool
+	// Envelope starts every payload with a header holding magic bytes, the
+	// format version and Flags recording the options above, so that
+	// payloads can be told apart from other data (see Sniff) and Decode
+	// reads each one as it was written whatever f's own options.
+	Envelope bool
+	// Fingerprint writes the Fingerprint of the top-level struct ahead of
+	// its fields. Decode checks any fingerprint it finds and rejects
+	// payloads written from a struct of another shape with
+	// ErrSchemaMismatch; with Fingerprint set it also rejects payloads
+	// without one. Types that encode themselves are written without one.
+	Fingerprint bool
+	// ExactResults makes Encode return every result in an allocation of
+	// exactly its size. By default small results are carved from shared
+	// memory chunks, which saves an allocation per call but keeps a whole
+	// chunk alive for as long as any result cut from it is; set it when
+	// results are kept for long, such as in a cache.
+	ExactResults bool
 }
 
 type Fractus struct {
@@ -27,25 +128,82 @@ type Fractus struct {
 	// plan stores per-type field metadata to avoid repeated reflection.
 	plan map[reflect.Type]*FieldPlan
 	mu   sync.RWMutex
-	// scratch is an 8-byte buffer reused for fixed-size encodings.
-	scratch []byte
-	buf     []byte
-	body    []byte
+	// pending lists the plans registered by the build in progress so they
+	// can be dropped together if it fails.
+	pending []reflect.Type
+	// codecs holds the codecs added with RegisterCodec.
+	codecs map[reflect.Type]*codec
+	// states pools the per-call encState of Encode, so one Fractus can be
+	// shared by many goroutines.
+	states sync.Pool
+	// readers holds the instances reading enveloped payloads written with
+	// other options; see reader.
+	readers map[SafeOptions]*Fractus
+	// fingerprints caches Fingerprint by type.
+	fingerprints map[reflect.Type]uint64
+	// tops caches how top-level struct types are encoded; see top.
+	tops map[reflect.Type]*topLevel
 }
 
 type FieldPlan struct {
 	fieldCount int
 	varCount   int
 	fixedSize  int
-	fields     []FieldInfo
+	// hasOmit is set when any field is tagged omitempty; such structs carry
+	// a presence bitmap after the field count.
+	hasOmit bool
+	// fields are ordered by id.
+	fields []FieldInfo
 }
 
 type FieldInfo struct {
-	idx       int
+	idx int
+	// name, id and omitEmpty come from the `fractus` struct tag; see tags.Parse.
+	name      string
+	id        int
+	omitEmpty bool
 	kind      reflect.Kind
 	isVar     bool
 	size      int
 	alignment int
+	// native is set for fixed-size values whose wire bytes match their
+	// in-memory layout, making them eligible for zero-copy paths.
+	native bool
+	// typ is the Go type described by this FieldInfo.
+	typ reflect.Type
+	// sub is the plan of a nested struct field.
+	sub *FieldPlan
+	// elem describes the element of a slice or array, the pointee of a
+	// pointer or the value of a map.
+	elem *FieldInfo
+	// key describes the key of a map field.
+	key *FieldInfo
+	// wire is the wire kind used for this value in self-describing mode.
+	wire WireKind
+	// custom is set for types implementing Marshaler and Unmarshaler or
+	// registered with RegisterCodec, in which case codec is set too.
+	// generated marks custom types written by cmd/fractusgen, which keep a
+	// reflective plan for the modes their methods do not cover.
+	custom    bool
+	generated bool
+	codec     *codec
+}
+
+// minWireSize returns the fewest bytes a value described by fi can occupy
+// on the wire. Decoders use it to reject counts the remaining input cannot
+// possibly satisfy before allocating.
+func (fi *FieldInfo) minWireSize() int {
+	if fi.custom {
+		return 1
+	}
+	if !fi.isVar {
+		return fi.size
+	}
+	if fi.kind == reflect.Array {
+		return fi.typ.Len() * fi.elem.minWireSize()
+	}
+	// every variable-size value starts with at least a one-byte prefix
+	return 1
 }
 
 // NewFractus constructs a new Fractus encoder/decoder.
@@ -53,9 +211,8 @@ type FieldInfo struct {
 // Provide SafeOptions to opt into unsafe, zero-copy modes.
 func NewFractus(opts SafeOptions) *Fractus {
 	return &Fractus{
-		Opts:    opts,
-		plan:    make(map[reflect.Type]*FieldPlan),
-		scratch: make([]byte, 8),
+		Opts: opts,
+		plan: make(map[reflect.Type]*FieldPlan),
 	}
 }
 
@@ -63,84 +220,240 @@ func NewFractus(opts SafeOptions) *Fractus {
 // getPlan inspects type `t` and returns a cached FieldPlan.
 // FieldPlans are used internally
 // and not expected to be used externally
-// It is concurrent safe
-// getPlan inspects type `t` and returns a cached FieldPlan.
 // It is safe for concurrent use: readers take the RLock and writers
 // populate the map only once per type.
-func (f *Fractus) getPlan(t reflect.Type) *FieldPlan {
+// An error wrapping ErrUnsupported is returned when `t` (or any nested
+// type) contains a field kind Fractus cannot encode.
+func (f *Fractus) getPlan(t reflect.Type) (*FieldPlan, error) {
 	f.mu.RLock()
 	if plan, ok := f.plan[t]; ok {
 		f.mu.RUnlock()
-		return plan
+		return plan, nil
 	}
 	f.mu.RUnlock()
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	plan, err := f.buildPlan(t)
+	if err != nil {
+		// Plans built along the way may point at the failed one.
+		for _, pt := range f.pending {
+			delete(f.plan, pt)
+		}
+	}
+	f.pending = f.pending[:0]
+	return plan, err
+}
 
+// buildPlan builds (or returns the cached) plan for struct type `t`.
+// The caller must hold f.mu for writing. The plan is registered before its
+// fields are classified so self-referencing types (e.g. linked lists through
+// pointers) resolve to the same plan instead of recursing forever.
+func (f *Fractus) buildPlan(t reflect.Type) (*FieldPlan, error) {
 	// Double-check
 	if plan, ok := f.plan[t]; ok {
-		return plan
+		return plan, nil
 	}
 
 	plan := &FieldPlan{}
+	f.plan[t] = plan
+	f.pending = append(f.pending, t)
 	fixedSize := 0
 	varCount := 0
+	nextID := 1
+	seen := make(map[int]string)
 
 	for i := 0; i < t.NumField(); i++ {
 		sf := t.Field(i)
-		if sf.PkgPath != "" && !sf.Anonymous {
+		if sf.PkgPath != "" && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		tag, err := tags.Parse(sf.Name, sf.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		if tag.Skip {
 			continue
 		}
 
-		kind := sf.Type.Kind()
-		isVar := !isFixedKind(kind)
-		size := FixedSize(kind)
-		alignment := getAlignment(kind)
-
-		fieldInfo := FieldInfo{
-			idx:       i,
-			kind:      kind,
-			isVar:     isVar,
-			size:      size,
-			alignment: alignment,
+		fieldInfo, err := f.typeInfo(sf.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		fieldInfo.idx = i
+		fieldInfo.name = tag.Name
+		fieldInfo.omitEmpty = tag.OmitEmpty
+		fieldInfo.id = nextID
+		if tag.ID != 0 {
+			fieldInfo.id = tag.ID
+		}
+		if other, dup := seen[fieldInfo.id]; dup {
+			return nil, fmt.Errorf("field %s.%s: %w: id %d already used by %s",
+				t.Name(), sf.Name, ErrInvalidTag, fieldInfo.id, other)
 		}
+		seen[fieldInfo.id] = sf.Name
+		nextID = fieldInfo.id + 1
+		plan.hasOmit = plan.hasOmit || tag.OmitEmpty
 
 		plan.fields = append(plan.fields, fieldInfo)
 
-		if isVar {
+		if fieldInfo.isVar {
 			varCount++
 		} else {
-			fixedSize += size
+			fixedSize += fieldInfo.size
 		}
 	}
 
+	// Field ids, not declaration order, decide the wire order.
+	slices.SortStableFunc(plan.fields, func(a, b FieldInfo) int { return a.id - b.id })
 	plan.fieldCount = len(plan.fields)
 	plan.varCount = varCount
 	plan.fixedSize = fixedSize
-
-	f.plan[t] = plan
-	return plan
+	return plan, nil
 }
 
-// Reset clears all buffer used during encoding/decoding
-// Reset clears internal buffers used during encode/decode so they can be reused.
-func (f *Fractus) Reset() {
-	if f.buf != nil {
-		f.buf = f.buf[:0]
+// typeInfo classifies a Go type for encoding, resolving sub-plans for
+// nested structs and pointees. The caller must hold f.mu for writing.
+func (f *Fractus) typeInfo(t reflect.Type) (FieldInfo, error) {
+	kind := t.Kind()
+	info := FieldInfo{
+		kind:      kind,
+		isVar:     !isFixedKind(kind),
+		size:      FixedSize(kind),
+		alignment: getAlignment(kind),
+		typ:       t,
+	}
+	if c := f.codecFor(t); c != nil {
+		info.custom, info.isVar, info.size, info.codec = true, true, 0, c
+		info.wire = WireBytes
+		return info, nil
+	}
+	custom, err := customCodec(t)
+	if err != nil {
+		return info, err
 	}
-	if f.body != nil {
-		f.body = f.body[:0]
+	if custom {
+		info.custom, info.isVar, info.size = true, true, 0
+		info.generated = reflect.PointerTo(t).Implements(generatedType)
+		if !info.generated {
+			info.wire = WireBytes
+			return info, nil
+		}
 	}
+	switch {
+	case isFixedKind(kind):
+		info.native = t.Size() == uintptr(info.size)
+	case kind == reflect.String:
+	case kind == reflect.Array:
+		elem, err := f.typeInfo(t.Elem())
+		if err != nil {
+			return info, err
+		}
+		info.elem = &elem
+		info.alignment = elem.alignment
+		if !elem.isVar {
+			// arrays of fixed-size elements are fixed-size themselves
+			info.isVar = false
+			info.size = t.Len() * elem.size
+			info.native = elem.native
+		}
+	case kind == reflect.Slice:
+		elem, err := f.typeInfo(t.Elem())
+		if err != nil {
+			return info, err
+		}
+		info.elem = &elem
+	case kind == reflect.Struct:
+		sub, err := f.buildPlan(t)
+		if err != nil {
+			return info, err
+		}
+		info.sub = sub
+	case kind == reflect.Ptr:
+		elem, err := f.typeInfo(t.Elem())
+		if err != nil {
+			return info, err
+		}
+		info.elem = &elem
+	case kind == reflect.Map:
+		key, err := f.typeInfo(t.Key())
+		if err != nil {
+			return info, err
+		}
+		elem, err := f.typeInfo(t.Elem())
+		if err != nil {
+			return info, err
+		}
+		info.key, info.elem = &key, &elem
+	default:
+		return info, fmt.Errorf("%w: %s", ErrUnsupported, t)
+	}
+	info.wire = wireKindOf(&info)
+	return info, nil
 }
 
+// Reset clears all buffer used during encoding/decoding
+//
+// Deprecated: Fractus no longer keeps buffers between calls, so Reset does
+// nothing.
+func (f *Fractus) Reset() {}
+
 // Encode turns the value provided into a byte slice(Fractus format binary)
 // The binary reflect the value encoded
 // only struct are accepted, only exported values are encoded
 // Encode serializes the provided struct value into Fractus binary format.
 // Only exported struct fields are encoded. Caller may enable zero-copy
 // modes via `Opts` but must then ensure the source buffer remains live.
+// The returned slice is never reused by f, but unless ExactResults is set
+// small results share memory chunks with other results; use AppendEncode
+// to encode into storage the caller owns. Encode is safe for concurrent
+// use.
 func (f *Fractus) Encode(in any) (out []byte, err error) {
+	v, tl, err := f.topValue(in)
+	if err != nil {
+		return nil, err
+	}
+	s := f.getState()
+	// The value is walked once, into scratch space, and then copied to a
+	// chunk or to an allocation of exactly its size.
+	payload, err := f.encodeScratch(s, v, tl)
+	switch {
+	case err != nil:
+	case f.Opts.ExactResults:
+		out = make([]byte, len(payload))
+		copy(out, payload)
+	default:
+		out = s.place(payload)
+	}
+	f.states.Put(s)
+	return out, err
+}
+
+// AppendEncode appends the encoding of in to dst and returns the extended
+// slice, growing dst only when it lacks capacity. A dst without spare
+// capacity, such as nil, is grown once. The result never aliases f's
+// internal buffers, so it can go straight into a caller's frame buffer. On
+// error dst is returned unchanged.
+func (f *Fractus) AppendEncode(dst []byte, in any) ([]byte, error) {
+	v, tl, err := f.topValue(in)
+	if err != nil {
+		return dst, err
+	}
+	if len(dst) < cap(dst) {
+		return f.encodeTop(dst, v, tl)
+	}
+	s := f.getState()
+	defer f.states.Put(s)
+	payload, err := f.encodeScratch(s, v, tl)
+	if err != nil {
+		return dst, err
+	}
+	return append(slices.Grow(dst, len(payload)), payload...), nil
+}
+
+// topValue returns the struct value in, or in points to, and how its type
+// is encoded.
+func (f *Fractus) topValue(in any) (reflect.Value, *topLevel, error) {
 	v := reflect.ValueOf(in)
 	// basics checks
 	if v.Kind() == reflect.Ptr {
@@ -148,145 +461,235 @@ func (f *Fractus) Encode(in any) (out []byte, err error) {
 	}
 	// only accept structs
 	if v.Kind() != reflect.Struct {
-		return nil, ErrNotStruct
+		return reflect.Value{}, nil, ErrNotStruct
 	}
+	tl, err := f.top(v.Type())
+	return v, tl, err
+}
+
+// encodeScratch encodes top-level `v` into the scratch buffer of s. The
+// result is only valid until s goes back to the pool.
+func (f *Fractus) encodeScratch(s *encState, v reflect.Value, tl *topLevel) ([]byte, error) {
+	out, err := f.encodeTop(s.scratch[:0], v, tl)
+	if err != nil {
+		return nil, err
+	}
+	s.keep(out)
+	return out, nil
+}
 
-	t := v.Type()
-	// retrieve plan
-	plan := f.getPlan(t)
-	estimatedSize := 16 + plan.fixedSize + (plan.varCount * 32) // Base + fixed + var
-	f.Reset()                                                   // reset buffer
+// encodeTop appends the encoding of top-level struct `v`, whose type is
+// described by tl. On error dst is returned unchanged. Every encode of a
+// top-level value ends here.
+func (f *Fractus) encodeTop(dst []byte, v reflect.Value, tl *topLevel) ([]byte, error) {
+	var out []byte
+	var err error
+	// Types that encode themselves skip the plan entirely.
+	if tl.codec != nil || tl.custom {
+		out, err = f.encodeSelf(dst, v, tl.codec)
+	} else {
+		// Write number of field discovered, then each field
+		out, err = f.encodeMessage(dst, v, tl.plan)
+	}
+	if err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// encodeMessage appends the encoding of top-level struct `v`: the struct
+// itself followed by its offset table when SafeOptions.OffsetTable is set,
+// framed by an envelope and checksum when those options are set.
+func (f *Fractus) encodeMessage(dst []byte, v reflect.Value, plan *FieldPlan) ([]byte, error) {
+	body, err := f.appendFingerprint(f.startFrame(dst, false), v.Type())
+	if err != nil {
+		return nil, err
+	}
+	out, err := f.encodeStruct(body, v, plan)
+	if err == nil && f.Opts.OffsetTable && !f.Opts.SelfDescribing {
+		out, err = f.appendOffsetTable(out, len(dst), len(body), plan)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.appendChecksum(out, len(dst)), nil
+}
 
-	// increase buffers size if needed
-	if cap(f.buf) < estimatedSize {
-		f.buf = make([]byte, 0, estimatedSize)
+// encodeSelf appends the payload of top-level `v`, whose type encodes
+// itself with codec c or, when c is nil, its MarshalFractus method, framed
+// by an envelope and checksum when those options are set.
+func (f *Fractus) encodeSelf(dst []byte, v reflect.Value, c *codec) ([]byte, error) {
+	// generated methods are not used with SafeOptions.Fingerprint, so v
+	// has no fingerprint to write
+	out := f.startFrame(dst, true)
+	var err error
+	if c != nil {
+		out, err = c.encode(out, v)
+	} else {
+		out, err = marshalValue(out, v)
 	}
-	if cap(f.body) < estimatedSize {
-		f.body = make([]byte, 0, estimatedSize)
+	if err != nil {
+		return nil, err
 	}
+	return f.appendChecksum(out, len(dst)), nil
+}
 
-	// Write number of field discovered
-	f.buf = writeVarUint(f.buf, uint64(plan.fieldCount))
+// encodeStruct appends the field count followed by every field of `v`.
+// Nested structs use the same layout as the top-level value.
+func (f *Fractus) encodeStruct(dst []byte, v reflect.Value, plan *FieldPlan) ([]byte, error) {
+	if f.Opts.SelfDescribing {
+		return f.encodeTagged(dst, v, plan)
+	}
+	dst = writeVarUint(dst, uint64(plan.fieldCount))
+	return f.encodeFields(dst, v, plan)
+}
 
-	// Encoding each fields
-	for _, field := range plan.fields {
+// encodeFields appends each field of `v` in plan order. Structs with
+// omitempty fields start with a presence bitmap (one bit per field, in plan
+// order) and empty omitempty fields are left out of the body.
+func (f *Fractus) encodeFields(dst []byte, v reflect.Value, plan *FieldPlan) ([]byte, error) {
+	var err error
+	bitmap := -1
+	if plan.hasOmit {
+		bitmap = len(dst)
+		dst = append(dst, make([]byte, (plan.fieldCount+7)/8)...)
+	}
+	for i := range plan.fields {
+		field := &plan.fields[i]
 		fieldValue := v.Field(field.idx)
-		if field.isVar {
-			// Encode directly into body
-			switch field.kind {
-			// string
-			case reflect.String:
-				if f.Opts.UnsafeStrings {
-					// unsafe encoding of strings (zero-copy from string header)
-					str := fieldValue.String()
-					strData := unsafe.Slice(unsafe.StringData(str), len(str))
-					f.body = writeVarUint(f.body, uint64(len(strData)))
-					f.body = append(f.body, strData...)
-				} else {
-					str := fieldValue.String()
-					f.body = writeVarUint(f.body, uint64(len(str)))
-					f.body = append(f.body, str...)
-				}
-			// slices
-			case reflect.Slice:
-				elemKind := fieldValue.Type().Elem().Kind()
-				length := fieldValue.Len()
-				f.body = writeVarUint(f.body, uint64(length))
-
-				if f.Opts.UnsafePrimitives && isFixedKind(elemKind) && length > 0 {
-					// unsafe encoding for slices of fixed-size primitives: attempt zero-copy
-					if !f.Opts.CheckAlignment || f.checkSliceAlignment(fieldValue, elemKind) {
-						fslice := fieldValue.Slice(0, fieldValue.Len())
-						if fslice.Len() != 0 {
-							elemSize := FixedSize(elemKind)
-							byteSlice := unsafe.Slice((*byte)(unsafe.Pointer(fslice.Pointer())), length*elemSize)
-							f.body = append(f.body, byteSlice...)
-						}
-					} else {
-						// Safe copy for unaligned data
-						for i := 0; i < length; i++ {
-							elem := fieldValue.Index(i)
-							f.body = f.encodeFixedToBuffer(elem, elemKind, f.body)
-						}
-					}
-				} else {
-					// Encode each element safely
-					for i := 0; i < length; i++ {
-						elem := fieldValue.Index(i)
-						if isFixedKind(elemKind) {
-							f.body = f.encodeFixedToBuffer(elem, elemKind, f.body)
-						} else if elemKind == reflect.String {
-							if f.Opts.UnsafeStrings {
-								strData := unsafe.Slice(unsafe.StringData(elem.String()), len(elem.String()))
-								f.body = writeVarUint(f.body, uint64(len(strData)))
-								f.body = append(f.body, strData...)
-							} else {
-								str := elem.String()
-								f.body = writeVarUint(f.body, uint64(len(str)))
-								f.body = append(f.body, str...)
-							}
-						} else {
-							return nil, ErrUnsupported
-						}
-					}
-				}
-			default:
-				return nil, ErrUnsupported
+		if bitmap >= 0 {
+			if field.omitEmpty && isEmptyValue(fieldValue) {
+				continue
 			}
-		} else {
-			// Fixed field - encode directly to body
-			f.encodeFixedToBody(fieldValue, field.kind)
+			dst[bitmap+i/8] |= 1 << (i % 8)
+		}
+		dst, err = f.encodeValue(dst, fieldValue, field)
+		if err != nil {
+			return nil, err
 		}
 	}
-
-	// Append body to buffer
-	f.buf = append(f.buf, f.body...)
-	return f.buf, nil
+	return dst, nil
 }
 
-// / *** Merging both into a single function is possible
-// encodes value based on their types
-// encodeFixedToBody encodes a fixed-size value directly into the current body buffer.
-// This method reuses the small `scratch` buffer to avoid allocations for numeric types.
-func (f *Fractus) encodeFixedToBody(v reflect.Value, kind reflect.Kind) {
-	switch kind {
-	case reflect.Bool:
-		if v.Bool() {
-			f.body = append(f.body, 1)
+// encodeValue appends a single value described by `info` to dst.
+func (f *Fractus) encodeValue(dst []byte, fieldValue reflect.Value, info *FieldInfo) ([]byte, error) {
+	if f.delegates(info) {
+		if fieldValue.CanInterface() {
+			return f.encodeCustom(dst, fieldValue, info)
+		}
+		// reached through an unexported embedded field
+		if !info.generated {
+			return nil, fmt.Errorf("%w: %s in unexported field", ErrUnsupported, info.typ)
+		}
+	}
+	if info.kind == reflect.Array {
+		return f.encodeArray(dst, fieldValue, info)
+	}
+	if !info.isVar {
+		// Fixed field - encode directly
+		return f.encodeFixedToBuffer(fieldValue, info.kind, dst), nil
+	}
+	// Encode directly into dst
+	switch info.kind {
+	// string
+	case reflect.String:
+		if f.Opts.UnsafeStrings {
+			// unsafe encoding of strings (zero-copy from string header)
+			str := fieldValue.String()
+			strData := unsafe.Slice(unsafe.StringData(str), len(str))
+			dst = writeVarUint(dst, uint64(len(strData)))
+			dst = append(dst, strData...)
 		} else {
-			f.body = append(f.body, 0)
+			str := fieldValue.String()
+			dst = writeVarUint(dst, uint64(len(str)))
+			dst = append(dst, str...)
 		}
-	case reflect.Int8:
-		f.body = append(f.body, byte(v.Int()))
-	case reflect.Uint8:
-		f.body = append(f.body, byte(v.Uint()))
-	case reflect.Int16:
-		binary.LittleEndian.PutUint16(f.scratch, uint16(v.Int()))
-		f.body = append(f.body, f.scratch[:2]...)
-	case reflect.Uint16:
-		binary.LittleEndian.PutUint16(f.scratch, uint16(v.Uint()))
-		f.body = append(f.body, f.scratch[:2]...)
-	case reflect.Int32:
-		binary.LittleEndian.PutUint32(f.scratch, uint32(v.Int()))
-		f.body = append(f.body, f.scratch[:4]...)
-	case reflect.Uint32:
-		binary.LittleEndian.PutUint32(f.scratch, uint32(v.Uint()))
-		f.body = append(f.body, f.scratch[:4]...)
-	case reflect.Int64:
-		binary.LittleEndian.PutUint64(f.scratch, uint64(v.Int()))
-		f.body = append(f.body, f.scratch[:8]...)
-	case reflect.Uint64:
-		binary.LittleEndian.PutUint64(f.scratch, v.Uint())
-		f.body = append(f.body, f.scratch[:8]...)
-	case reflect.Float32:
-		binary.LittleEndian.PutUint32(f.scratch, math.Float32bits(float32(v.Float())))
-		f.body = append(f.body, f.scratch[:4]...)
-	case reflect.Float64:
-		binary.LittleEndian.PutUint64(f.scratch, math.Float64bits(v.Float()))
-		f.body = append(f.body, f.scratch[:8]...)
+	// slices
+	case reflect.Slice:
+		elem := info.elem
+		length := fieldValue.Len()
+		dst = writeVarUint(dst, uint64(length))
+
+		if f.Opts.UnsafePrimitives && elem.native && length > 0 &&
+			(!f.Opts.CheckAlignment || f.checkSliceAlignment(fieldValue, elem.alignment)) {
+			// unsafe encoding for slices of fixed-size primitives: zero-copy
+			byteSlice := unsafe.Slice((*byte)(unsafe.Pointer(fieldValue.Pointer())), length*elem.size)
+			dst = append(dst, byteSlice...)
+		} else {
+			// Encode each element with its own plan; this recurses for
+			// slices of structs, maps or other slices.
+			var err error
+			for i := 0; i < length; i++ {
+				if dst, err = f.encodeValue(dst, fieldValue.Index(i), elem); err != nil {
+					return nil, err
+				}
+			}
+		}
+	// nested struct: VarInt byte length + struct encoding
+	case reflect.Struct:
+		start := len(dst)
+		dst, err := f.encodeStruct(dst, fieldValue, info.sub)
+		if err != nil {
+			return nil, err
+		}
+		return insertVarUint(dst, start, uint64(len(dst)-start)), nil
+	// pointer: presence byte, then the pointee when non-nil
+	case reflect.Ptr:
+		if fieldValue.IsNil() {
+			return append(dst, 0), nil
+		}
+		return f.encodeValue(append(dst, 1), fieldValue.Elem(), info.elem)
+	// map: VarInt entry count, then key/value pairs ordered by encoded key
+	case reflect.Map:
+		return f.encodeMap(dst, fieldValue, info)
 	default:
-		panic("unsupported fixed kind")
+		return nil, ErrUnsupported
+	}
+	return dst, nil
+}
+
+// encodeArray writes the elements of a [N]T inline with no length prefix,
+// since N is part of the type. Arrays of primitives are copied in one go
+// when UnsafePrimitives is set and the array is addressable.
+func (f *Fractus) encodeArray(dst []byte, v reflect.Value, info *FieldInfo) ([]byte, error) {
+	if f.Opts.UnsafePrimitives && info.native && info.size > 0 && v.CanAddr() {
+		return append(dst, unsafe.Slice((*byte)(v.Addr().UnsafePointer()), info.size)...), nil
+	}
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if dst, err = f.encodeValue(dst, v.Index(i), info.elem); err != nil {
+			return nil, err
+		}
 	}
+	return dst, nil
+}
+
+// encodeMap writes the entry count followed by every entry sorted by its
+// encoded key bytes (ties broken by the encoded value), so equal maps always
+// produce identical bytes regardless of Go's randomized iteration order.
+func (f *Fractus) encodeMap(dst []byte, m reflect.Value, info *FieldInfo) ([]byte, error) {
+	n := m.Len()
+	dst = writeVarUint(dst, uint64(n))
+	if n == 0 {
+		return dst, nil
+	}
+	entries := make([]MapEntry, 0, n)
+	var entryBuf []byte
+	var err error
+	iter := m.MapRange()
+	for iter.Next() {
+		e := MapEntry{Start: len(entryBuf)}
+		if entryBuf, err = f.encodeValue(entryBuf, iter.Key(), info.key); err != nil {
+			return nil, err
+		}
+		e.KeyEnd = len(entryBuf)
+		if entryBuf, err = f.encodeValue(entryBuf, iter.Value(), info.elem); err != nil {
+			return nil, err
+		}
+		e.End = len(entryBuf)
+		entries = append(entries, e)
+	}
+	return AppendMapEntries(dst, entryBuf, entries), nil
 }
 
 // encodes value based on their types
@@ -304,29 +707,21 @@ func (f *Fractus) encodeFixedToBuffer(v reflect.Value, kind reflect.Kind, dst []
 	case reflect.Uint8:
 		return append(dst, byte(v.Uint()))
 	case reflect.Int16:
-		binary.LittleEndian.PutUint16(f.scratch, uint16(v.Int()))
-		return append(dst, f.scratch[:2]...)
+		return binary.LittleEndian.AppendUint16(dst, uint16(v.Int()))
 	case reflect.Uint16:
-		binary.LittleEndian.PutUint16(f.scratch, uint16(v.Uint()))
-		return append(dst, f.scratch[:2]...)
+		return binary.LittleEndian.AppendUint16(dst, uint16(v.Uint()))
 	case reflect.Int32:
-		binary.LittleEndian.PutUint32(f.scratch, uint32(v.Int()))
-		return append(dst, f.scratch[:4]...)
+		return binary.LittleEndian.AppendUint32(dst, uint32(v.Int()))
 	case reflect.Uint32:
-		binary.LittleEndian.PutUint32(f.scratch, uint32(v.Uint()))
-		return append(dst, f.scratch[:4]...)
-	case reflect.Int64:
-		binary.LittleEndian.PutUint64(f.scratch, uint64(v.Int()))
-		return append(dst, f.scratch[:8]...)
-	case reflect.Uint64:
-		binary.LittleEndian.PutUint64(f.scratch, v.Uint())
-		return append(dst, f.scratch[:8]...)
+		return binary.LittleEndian.AppendUint32(dst, uint32(v.Uint()))
+	case reflect.Int64, reflect.Int:
+		return binary.LittleEndian.AppendUint64(dst, uint64(v.Int()))
+	case reflect.Uint64, reflect.Uint, reflect.Uintptr:
+		return binary.LittleEndian.AppendUint64(dst, v.Uint())
 	case reflect.Float32:
-		binary.LittleEndian.PutUint32(f.scratch, math.Float32bits(float32(v.Float())))
-		return append(dst, f.scratch[:4]...)
+		return binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(v.Float())))
 	case reflect.Float64:
-		binary.LittleEndian.PutUint64(f.scratch, math.Float64bits(v.Float()))
-		return append(dst, f.scratch[:8]...)
+		return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v.Float()))
 	default:
 		panic("unsupported fixed kind")
 	}
@@ -339,125 +734,291 @@ func (f *Fractus) encodeFixedToBuffer(v reflect.Value, kind reflect.Kind, dst []
 // If unsafe modes are enabled decoded strings/slices may alias the original
 // input buffer; the caller must ensure the input remains valid while values
 // are used. For a safe wrapper that retains the payload, use `SafeDecoder`.
+// Truncated or corrupt input is reported as a *DecodeError; Decode never
+// reads past the end of `in`. Decode is safe for concurrent use.
 func (f *Fractus) Decode(in []byte, out any) (err error) {
-	f.Reset()
 	v := reflect.ValueOf(out)
 	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
 		return ErrNotStructPtr
 	}
-
 	dst := v.Elem()
-	t := dst.Type()
-	plan := f.getPlan(t)
+	tl, err := f.top(dst.Type())
+	if err != nil {
+		return err
+	}
+	return f.decodeFramed(in, dst, tl)
+}
 
-	// Read field count
-	N, cursor := readVarUint(in)
-	if N == 0 {
-		return nil
+// decodeFramed decodes the payload in, frame included, into dst, whose
+// type is described by tl. Decode and Codec.Unmarshal both end here.
+func (f *Fractus) decodeFramed(in []byte, dst reflect.Value, tl *topLevel) error {
+	if err := f.Opts.Limits.checkBytes(in); err != nil {
+		return err
+	}
+	body, base, r, err := f.openFrame(in, tl.opaque)
+	if err != nil {
+		return err
+	}
+	if r != f {
+		// written with other options; see SafeOptions.Envelope
+		if tl, err = r.top(dst.Type()); err != nil {
+			return err
+		}
+	}
+	// errors are reported at their offset in `in`, not in the body
+	return rebase(r.decodeBody(body, dst, tl), base)
+}
+
+// decodeBody decodes a top-level payload stripped of its frame into dst,
+// whose type is described by tl.
+func (f *Fractus) decodeBody(in []byte, dst reflect.Value, tl *topLevel) error {
+	if tl.codec != nil {
+		return tl.codec.decode(in, dst)
+	}
+	if tl.opaque {
+		return dst.Addr().Interface().(Unmarshaler).UnmarshalFractus(in)
 	}
+	pos, err := f.readFingerprint(in, dst.Type())
+	if err != nil {
+		return err
+	}
+	if tl.custom {
+		// generated methods read the reflective layout, which starts
+		// after the fingerprint
+		return rebase(dst.Addr().Interface().(Unmarshaler).UnmarshalFractus(in[pos:]), pos)
+	}
+	// Positions are absolute offsets into `in`. The input is never stored on
+	// `f` so it cannot alias the encoder's reusable buffers.
+	if pos, err := f.decodeStruct(in, pos, dst, tl.plan, 0); err != nil {
+		return fieldErr(pos, -1, err)
+	}
+	return nil
+}
 
-	// Set body reference
-	f.body = in[cursor:]
-	bodyPos := 0
-	var varIdx int
+// decodeStruct reads a field count at in[pos] followed by the fields of
+// `plan` into dst. It returns the position after the struct, or the offset
+// of the failure together with the error.
+func (f *Fractus) decodeStruct(in []byte, pos int, dst reflect.Value, plan *FieldPlan, depth int) (int, error) {
+	if f.Opts.SelfDescribing {
+		return f.decodeTagged(in, pos, dst, plan, depth)
+	}
+	N, bitmap, pos, err := f.readHeader(in, pos, plan)
+	if err != nil {
+		return pos, err
+	}
 
-	// Decode fields in order
-	for _, field := range plan.fields {
+	// Decode fields in order. Fields past N were added after the payload
+	// was written and fields past the plan were added after this struct
+	// was compiled; the former are zeroed, the latter left unread (nested
+	// structs are bounded by their length prefix, trailing bytes of the
+	// top-level value are ignored).
+	for i := range plan.fields {
+		field := &plan.fields[i]
 		fv := dst.Field(field.idx)
-		if field.isVar {
-			varIdx++
-			// Read length prefix
-			switch field.kind {
-			case reflect.String:
-				length, n := readVarUint(f.body[bodyPos:])
-				payload := f.body[bodyPos+n : bodyPos+n+int(length)]
-				bodyPos += int(length) + n
-				if f.Opts.UnsafeStrings {
-					if len(payload) > 0 {
-						str := unsafe.String(&payload[0], len(payload))
-						fv.SetString(str)
-					} else {
-						fv.SetString("")
-					}
-				} else {
-					fv.SetString(string(payload))
-				}
-			case reflect.Slice:
-				elemKind := fv.Type().Elem().Kind()
-				count, n2 := readVarUint(f.body[bodyPos:])
-				pos := bodyPos + n2
-
-				bodyPos += n2
-				if f.Opts.UnsafePrimitives && isFixedKind(elemKind) && int(count) > 0 {
-					// Zero-copy for primitive slices
-					elemSize := FixedSize(elemKind)
-					requiredSize := int(count) * elemSize
-					if pos+requiredSize <= len(f.body) {
-						setUnsafeFixed(fv, f.body[bodyPos:], elemKind, int(count))
-						pos += requiredSize
-					} else { // fallback
-						//  allocate only when needed
-						slice := reflect.MakeSlice(fv.Type(), int(count), int(count))
-						// Fall back to safe decoding
-						for i := 0; i < int(count); i++ {
-							elem := slice.Index(i)
-							setFixed(elem, f.body[pos:pos+elemSize], elemKind)
-							pos += elemSize
-						}
-						fv.Set(slice)
-					}
-					bodyPos += requiredSize
-				} else {
-					//  allocate only when needed
-					slice := reflect.MakeSlice(fv.Type(), int(count), int(count))
-					// Safe element-by-element decoding
-					for i := 0; i < int(count); i++ {
-						elem := slice.Index(i)
-						if isFixedKind(elemKind) {
-							size := FixedSize(elemKind)
-							setFixed(elem, f.body[pos:pos+size], elemKind)
-							pos += size
-							bodyPos += size
-						} else if elemKind == reflect.String {
-							strLen, n3 := readVarUint(f.body[pos:])
-							pos += n3
-							strData := f.body[pos : pos+int(strLen)]
-							if f.Opts.UnsafeStrings {
-								elem.SetString(unsafe.String(&strData[0], len(strData)))
-							} else {
-								elem.SetString(string(strData))
-							}
-							pos += int(strLen)
-							bodyPos += int(strLen) + n3
-						} else {
-							return ErrUnsupported
-						}
-					}
-					fv.Set(slice)
-				}
+		if uint64(i) >= N || !present(bitmap, i) {
+			// missing or omitted: clear whatever the destination held
+			fv.SetZero()
+			continue
+		}
+		next, err := f.decodeValue(in, pos, fv, field, depth+1)
+		if err != nil {
+			return next, fieldErr(next, field.idx, err)
+		}
+		pos = next
+	}
+	return pos, nil
+}
+
+// readHeader reads the field count and presence bitmap of the compact
+// struct encoding at in[pos] and returns the position of its first field.
+func (f *Fractus) readHeader(in []byte, pos int, plan *FieldPlan) (N uint64, bitmap []byte, next int, err error) {
+	N, pos, err = readVarUintAt(in, pos)
+	if err != nil {
+		return 0, nil, pos, err
+	}
+	if N != uint64(plan.fieldCount) && !f.Opts.Compatible {
+		return 0, nil, pos, ErrFieldCount
+	}
+	if plan.hasOmit {
+		if N > uint64(len(in)-pos)*8 {
+			return 0, nil, pos, ErrLengthTooLarge
+		}
+		n := int(N+7) / 8
+		bitmap = in[pos : pos+n]
+		pos += n
+	}
+	return N, bitmap, pos, nil
+}
+
+// present reports whether field i was written according to a presence
+// bitmap; a nil bitmap means every field was.
+func present(bitmap []byte, i int) bool {
+	return bitmap == nil || bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// decodeValue reads one value described by `info` from in[pos] into fv and
+// returns the position just past it. depth is how deeply the value is
+// nested, for DecodeLimits.MaxDepth. On failure the returned position is
+// the offset where decoding stopped.
+func (f *Fractus) decodeValue(in []byte, pos int, fv reflect.Value, info *FieldInfo, depth int) (int, error) {
+	if f.delegates(info) {
+		if fv.CanInterface() {
+			return f.decodeCustom(in, pos, fv, info)
+		}
+		if !info.generated {
+			return pos, fmt.Errorf("%w: %s in unexported field", ErrUnsupported, info.typ)
+		}
+	}
+	limits := &f.Opts.Limits
+	if info.isVar && info.kind != reflect.String {
+		if err := limits.checkDepth(depth); err != nil {
+			return pos, err
+		}
+	}
+	if info.kind == reflect.Array {
+		return f.decodeArray(in, pos, fv, info, depth)
+	}
+	if !info.isVar {
+		// Fixed field
+		if err := setFixed(fv, in[pos:], info.kind); err != nil {
+			return pos, err
+		}
+		return pos + info.size, nil
+	}
+	// Read length prefix
+	switch info.kind {
+	case reflect.String:
+		length, next, err := readCountAt(in, pos, 1)
+		if err != nil {
+			return pos, err
+		}
+		if over(length, limits.MaxString) {
+			return pos, fmt.Errorf("%w: string of %d bytes", ErrLimitExceeded, length)
+		}
+		payload := in[next : next+length]
+		if f.Opts.UnsafeStrings {
+			if len(payload) > 0 {
+				str := unsafe.String(&payload[0], len(payload))
+				fv.SetString(str)
+			} else {
+				fv.SetString("")
 			}
 		} else {
-			// Fixed field
-			size := FixedSize(field.kind)
-			setFixed(fv, f.body[bodyPos:bodyPos+size], field.kind)
-			bodyPos += size
+			fv.SetString(string(payload))
 		}
+		return next + length, nil
+	case reflect.Slice:
+		elem := info.elem
+		count, next, err := readCountAt(in, pos, elem.minWireSize())
+		if err != nil {
+			return pos, err
+		}
+		if err := limits.checkElems(count); err != nil {
+			return pos, err
+		}
+		pos = next
+		if f.Opts.UnsafePrimitives && elem.native && count > 0 {
+			// Zero-copy for primitive slices; readCountAt guarantees
+			// count*elem.size bytes remain.
+			setUnsafeFixed(fv, in[pos:], count)
+			return pos + count*elem.size, nil
+		}
+		//  allocate only when needed
+		slice := reflect.MakeSlice(fv.Type(), count, count)
+		// Safe element-by-element decoding
+		for i := 0; i < count; i++ {
+			if pos, err = f.decodeValue(in, pos, slice.Index(i), elem, depth+1); err != nil {
+				return pos, err
+			}
+		}
+		fv.Set(slice)
+		return pos, nil
+	case reflect.Struct:
+		length, next, err := readCountAt(in, pos, 1)
+		if err != nil {
+			return pos, err
+		}
+		end := next + length
+		// Bound the nested decode to its own bytes; anything the plan does
+		// not consume is skipped.
+		if at, err := f.decodeStruct(in[:end], next, fv, info.sub, depth); err != nil {
+			return at, err
+		}
+		return end, nil
+	case reflect.Ptr:
+		if pos >= len(in) {
+			return pos, ErrTruncated
+		}
+		switch in[pos] {
+		case 0:
+			fv.Set(reflect.Zero(fv.Type()))
+			return pos + 1, nil
+		case 1:
+			if fv.IsNil() {
+				fv.Set(reflect.New(info.typ.Elem()))
+			}
+			return f.decodeValue(in, pos+1, fv.Elem(), info.elem, depth+1)
+		default:
+			return pos, ErrInvalidPresence
+		}
+	case reflect.Map:
+		count, next, err := readCountAt(in, pos, info.key.minWireSize()+info.elem.minWireSize())
+		if err != nil {
+			return pos, err
+		}
+		if err := limits.checkElems(count); err != nil {
+			return pos, err
+		}
+		pos = next
+		m := reflect.MakeMapWithSize(info.typ, count)
+		for i := 0; i < count; i++ {
+			key := reflect.New(info.key.typ).Elem()
+			if pos, err = f.decodeValue(in, pos, key, info.key, depth+1); err != nil {
+				return pos, err
+			}
+			val := reflect.New(info.elem.typ).Elem()
+			if pos, err = f.decodeValue(in, pos, val, info.elem, depth+1); err != nil {
+				return pos, err
+			}
+			m.SetMapIndex(key, val)
+		}
+		fv.Set(m)
+		return pos, nil
 	}
+	return pos, ErrUnsupported
+}
 
-	return nil
+// decodeArray reads the N elements of a [N]T stored inline. Arrays of
+// primitives are filled with a single copy when UnsafePrimitives is set.
+func (f *Fractus) decodeArray(in []byte, pos int, fv reflect.Value, info *FieldInfo, depth int) (int, error) {
+	if !info.isVar {
+		if len(in)-pos < info.size {
+			return pos, ErrTruncated
+		}
+		if f.Opts.UnsafePrimitives && info.native && info.size > 0 && fv.CanAddr() {
+			copy(unsafe.Slice((*byte)(fv.Addr().UnsafePointer()), info.size), in[pos:])
+			return pos + info.size, nil
+		}
+	}
+	var err error
+	for i := 0; i < fv.Len(); i++ {
+		if pos, err = f.decodeValue(in, pos, fv.Index(i), info.elem, depth+1); err != nil {
+			return pos, err
+		}
+	}
+	return pos, nil
 }
 
 // Checks alignement to avoid common issues
 // internal function
 // checkSliceAlignment returns true when the slice's first element address is
-// aligned for the element kind. This is required before performing zero-copy
+// aligned for the element type. This is required before performing zero-copy
 // conversions from []T to []byte.
-func (f *Fractus) checkSliceAlignment(v reflect.Value, elemKind reflect.Kind) bool {
+func (f *Fractus) checkSliceAlignment(v reflect.Value, alignment int) bool {
 	if v.Len() == 0 {
 		return true
 	}
 	addr := v.Index(0).UnsafeAddr()
-	alignment := getAlignment(elemKind)
 	return addr%uintptr(alignment) == 0
 }
 
@@ -473,6 +1034,8 @@ func getAlignment(kind reflect.Kind) int {
 		return 4
 	case reflect.Int64, reflect.Uint64, reflect.Float64:
 		return 8
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return int(unsafe.Alignof(uintptr(0)))
 	default:
 		return 1
 	}
@@ -1,10 +1,22 @@
 package fractus
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
+	"time"
 
+	"github.com/rawbytedev/fractus/plugins"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -396,3 +408,1868 @@ func BenchmarkDoubleFractus(b *testing.B) {
 	f.Decode(res, y)
 	require.EqualValues(b, v, *y)
 }
+
+// Every strict prefix of a valid payload must fail with a typed error, never panic.
+func TestDecode_TruncatedInput(t *testing.T) {
+	type T struct {
+		A int32
+		S string
+		B []int16
+		L []string
+		F float64
+	}
+	for _, opts := range []SafeOptions{{}, {UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(T{A: 7, S: "hello", B: []int16{1, 2, 3}, L: []string{"x", ""}, F: 1.5})
+		require.NoError(t, err)
+		data = append([]byte(nil), data...)
+		for i := 0; i < len(data); i++ {
+			var out T
+			err := f.Decode(data[:i], &out)
+			require.Error(t, err, "prefix length %d", i)
+			var de *DecodeError
+			require.ErrorAs(t, err, &de)
+			require.LessOrEqual(t, de.Offset, i)
+			if !errors.Is(err, ErrTruncated) {
+				require.ErrorIs(t, err, ErrLengthTooLarge)
+			}
+		}
+		var out T
+		require.NoError(t, f.Decode(data, &out))
+	}
+}
+
+func TestDecode_CorruptInput(t *testing.T) {
+	type T struct {
+		A int8
+		S string
+	}
+	f := NewFractus(SafeOptions{})
+
+	// Field count varint that never terminates within 10 bytes.
+	overflow := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+	err := f.Decode(overflow, &T{})
+	require.ErrorIs(t, err, ErrVarintOverflow)
+
+	// String length claims far more than the remaining input.
+	huge := []byte{2, 1, 0xff, 0xff, 0xff, 0xff, 0x0f, 'a'}
+	err = f.Decode(huge, &T{})
+	require.ErrorIs(t, err, ErrLengthTooLarge)
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, 2, de.Offset)
+	require.Equal(t, 1, de.Field)
+}
+
+func FuzzDecode_NoPanic(f *testing.F) {
+	type T struct {
+		A int16
+		S string
+		B []uint32
+		L []string
+	}
+	enc := NewFractus(SafeOptions{})
+	seed, _ := enc.Encode(T{A: 1, S: "seed", B: []uint32{1, 2}, L: []string{"a", "bc"}})
+	f.Add(append([]byte(nil), seed...))
+	f.Add([]byte{0x80})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dec := NewFractus(SafeOptions{UnsafeStrings: true, UnsafePrimitives: true})
+		var out T
+		_ = dec.Decode(data, &out)
+	})
+}
+
+func TestRoundTrip_NestedStructs(t *testing.T) {
+	type Inner struct {
+		ID   int64
+		Tags []string
+	}
+	type Middle struct {
+		Name  string
+		Inner Inner
+		Opt   *Inner
+	}
+	type Outer struct {
+		A   int32
+		Mid Middle
+		Ptr *Middle
+		Nil *Middle
+		B   bool
+	}
+	v := Outer{
+		A:   -5,
+		Mid: Middle{Name: "mid", Inner: Inner{ID: 9, Tags: []string{"a", "b"}}},
+		Ptr: &Middle{Name: "ptr", Inner: Inner{Tags: []string{}}, Opt: &Inner{ID: 42, Tags: []string{"c"}}},
+		B:   true,
+	}
+	for _, opts := range []SafeOptions{{}, {UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(&v)
+		require.NoError(t, err)
+		out := Outer{Nil: &Middle{Name: "stale"}}
+		require.NoError(t, f.Decode(data, &out))
+		require.Equal(t, v, out)
+	}
+}
+
+func TestRoundTrip_RecursivePointers(t *testing.T) {
+	type Node struct {
+		Val  int16
+		Next *Node
+	}
+	v := Node{Val: 1, Next: &Node{Val: 2, Next: &Node{Val: 3}}}
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(v)
+	require.NoError(t, err)
+	var out Node
+	require.NoError(t, f.Decode(data, &out))
+	require.Equal(t, v, out)
+}
+
+func TestDecode_InvalidPresenceMarker(t *testing.T) {
+	type Inner struct{ X int8 }
+	type T struct{ P *Inner }
+	f := NewFractus(SafeOptions{})
+	err := f.Decode([]byte{1, 7}, &T{})
+	require.ErrorIs(t, err, ErrInvalidPresence)
+}
+
+func TestEncode_UnsupportedFieldKind(t *testing.T) {
+	type T struct{ C chan int }
+	f := NewFractus(SafeOptions{})
+	_, err := f.Encode(T{})
+	require.ErrorIs(t, err, ErrUnsupported)
+	err = f.Decode([]byte{1, 0}, &T{})
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestRoundTrip_Maps(t *testing.T) {
+	type Point struct{ X, Y int32 }
+	type T struct {
+		Counts map[string]int64
+		ByID   map[uint16]string
+		Points map[int8]Point
+		Nested map[string]map[int32]bool
+		Lists  map[string][]float32
+		Empty  map[string]int8
+	}
+	v := T{
+		Counts: map[string]int64{"a": 1, "bb": -2, "": 3},
+		ByID:   map[uint16]string{1: "one", 300: "three hundred"},
+		Points: map[int8]Point{-1: {1, 2}, 5: {3, 4}},
+		Nested: map[string]map[int32]bool{"x": {1: true, 2: false}, "y": {}},
+		Lists:  map[string][]float32{"l": {1.5, 2.5}},
+		Empty:  map[string]int8{},
+	}
+	for _, opts := range []SafeOptions{{}, {UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(v)
+		require.NoError(t, err)
+		var out T
+		require.NoError(t, f.Decode(data, &out))
+		require.Equal(t, v, out)
+	}
+}
+
+// Equal maps must encode to identical bytes regardless of insertion order.
+func TestEncode_MapDeterministic(t *testing.T) {
+	type T struct{ M map[string]uint32 }
+	a := T{M: map[string]uint32{}}
+	b := T{M: map[string]uint32{}}
+	for i := 0; i < 64; i++ {
+		a.M[fmt.Sprint(i)] = uint32(i)
+		b.M[fmt.Sprint(63-i)] = uint32(63 - i)
+	}
+	f := NewFractus(SafeOptions{})
+	first, err := f.Encode(a)
+	require.NoError(t, err)
+	first = append([]byte(nil), first...)
+	for i := 0; i < 10; i++ {
+		second, err := f.Encode(b)
+		require.NoError(t, err)
+		require.Equal(t, first, second)
+	}
+}
+
+func TestDecode_MapCountTooLarge(t *testing.T) {
+	type T struct{ M map[uint32]uint64 }
+	f := NewFractus(SafeOptions{})
+	// 1 field, map claims 1000 entries of 12 bytes but only 12 bytes follow.
+	in := append([]byte{1, 0xe8, 0x07}, make([]byte, 12)...)
+	err := f.Decode(in, &T{})
+	require.ErrorIs(t, err, ErrLengthTooLarge)
+}
+
+func TestRoundTrip_NestedSlices(t *testing.T) {
+	type Order struct {
+		ID    uint64
+		Items []string
+		Price float64
+	}
+	type T struct {
+		Orders  []Order
+		Blobs   [][]byte
+		Matrix  [][]float64
+		Deep    [][][]string
+		Ptrs    []*Order
+		Indexes []map[string]int16
+	}
+	v := T{
+		Orders:  []Order{{ID: 1, Items: []string{"a"}, Price: 2.5}, {ID: 2, Items: []string{}}},
+		Blobs:   [][]byte{{1, 2, 3}, {}, {0xff}},
+		Matrix:  [][]float64{{1, 2}, {3.5}},
+		Deep:    [][][]string{{{"x", ""}, {}}, {}},
+		Ptrs:    []*Order{nil, {ID: 3, Items: []string{"z"}}},
+		Indexes: []map[string]int16{{"k": 1}, {}},
+	}
+	for _, opts := range []SafeOptions{{}, {UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(v)
+		require.NoError(t, err)
+		var out T
+		require.NoError(t, f.Decode(data, &out))
+		require.Equal(t, v, out)
+	}
+}
+
+func FuzzNestedSlices(f *testing.F) {
+	f.Fuzz(func(t *testing.T, a, b []byte, s string) {
+		type X struct {
+			A [][]byte
+			S [][]string
+		}
+		fst := NewFractus(SafeOptions{})
+		val := X{A: [][]byte{a, b}, S: [][]string{{s}, {s, s}}}
+		data, err := fst.Encode(val)
+		require.NoError(t, err)
+		var out X
+		require.NoError(t, fst.Decode(data, &out))
+		require.Equal(t, len(val.A), len(out.A))
+		require.Equal(t, string(a), string(out.A[0]))
+		require.Equal(t, string(b), string(out.A[1]))
+		require.Equal(t, val.S, out.S)
+	})
+}
+
+func TestRoundTrip_Arrays(t *testing.T) {
+	type Point struct{ X, Y int32 }
+	type T struct {
+		Hash   [32]byte
+		Vec    [4]float32
+		Names  [2]string
+		Grid   [3][2]int16
+		Points [2]Point
+		Rows   [][3]float64
+		ByKey  map[[4]byte]string
+		Empty  [0]int64
+	}
+	v := T{
+		Vec:    [4]float32{1, -2, 3.5, 4},
+		Names:  [2]string{"a", ""},
+		Grid:   [3][2]int16{{1, 2}, {3, 4}, {5, -6}},
+		Points: [2]Point{{1, 2}, {3, 4}},
+		Rows:   [][3]float64{{1, 2, 3}, {4, 5, 6}},
+		ByKey:  map[[4]byte]string{{1, 2, 3, 4}: "x"},
+	}
+	for i := range v.Hash {
+		v.Hash[i] = byte(i * 7)
+	}
+	safe := NewFractus(SafeOptions{})
+	want, err := safe.Encode(v)
+	require.NoError(t, err)
+	want = append([]byte(nil), want...)
+	for _, opts := range []SafeOptions{{}, {UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		// Encode through a pointer so arrays are addressable and may take
+		// the zero-copy path; the bytes must not change.
+		data, err := f.Encode(&v)
+		require.NoError(t, err)
+		require.Equal(t, want, data)
+		var out T
+		require.NoError(t, f.Decode(data, &out))
+		require.Equal(t, v, out)
+	}
+}
+
+// Arrays of fixed-size kinds are written inline and count as fixed size.
+func TestPlan_FixedArrays(t *testing.T) {
+	type T struct {
+		Hash [32]byte
+		Vec  [4]float32
+		S    [2]string
+	}
+	f := NewFractus(SafeOptions{})
+	plan, err := f.getPlan(reflect.TypeOf(T{}))
+	require.NoError(t, err)
+	require.Equal(t, 32+16, plan.fixedSize)
+	require.Equal(t, 1, plan.varCount)
+
+	data, err := f.Encode(T{})
+	require.NoError(t, err)
+	// field count + 48 inline bytes + two empty string prefixes
+	require.Len(t, data, 1+48+2)
+}
+
+func TestRoundTrip_PlatformInts(t *testing.T) {
+	type T struct {
+		I  int
+		U  uint
+		P  uintptr
+		Is []int
+		Us [3]uint
+		M  map[int]uint
+	}
+	for _, opts := range []SafeOptions{{}, {UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		condition := func(v T) bool {
+			data, err := f.Encode(&v)
+			require.NoError(t, err)
+			var out T
+			require.NoError(t, f.Decode(data, &out))
+			if v.Is == nil {
+				v.Is = []int{}
+			}
+			if v.M == nil {
+				v.M = map[int]uint{}
+			}
+			return assert.ObjectsAreEqual(v, out)
+		}
+		require.NoError(t, quick.Check(condition, &quick.Config{}))
+	}
+}
+
+// Platform-width ints are always 8 bytes on the wire; a value that does not
+// fit the destination (as on 32-bit platforms) must be rejected, not truncated.
+func TestDecode_PlatformIntOverflow(t *testing.T) {
+	b := []byte{0, 0, 0, 0, 1, 0, 0, 0} // 1<<32
+	var narrow int32
+	err := setFixed(reflect.ValueOf(&narrow).Elem(), b, reflect.Int)
+	require.ErrorIs(t, err, ErrIntOverflow)
+	var unarrow uint32
+	err = setFixed(reflect.ValueOf(&unarrow).Elem(), b, reflect.Uint)
+	require.ErrorIs(t, err, ErrIntOverflow)
+}
+
+func TestTags_SkipRenameOmitEmpty(t *testing.T) {
+	type Inner struct{ V int32 }
+	type T struct {
+		Keep    string `fractus:"keep_name"`
+		Secret  string `fractus:"-"`
+		Note    string `fractus:",omitempty"`
+		Count   int64  `fractus:"count,omitempty"`
+		Items   []int8 `fractus:",omitempty"`
+		Ptr     *Inner `fractus:",omitempty"`
+		Present uint16
+	}
+	f := NewFractus(SafeOptions{})
+	plan, err := f.getPlan(reflect.TypeOf(T{}))
+	require.NoError(t, err)
+	require.Equal(t, 6, plan.fieldCount)
+	require.Equal(t, "keep_name", plan.fields[0].name)
+	require.True(t, plan.fields[2].omitEmpty)
+
+	v := T{Keep: "k", Secret: "hidden", Present: 9}
+	data, err := f.Encode(v)
+	require.NoError(t, err)
+	// count + bitmap + "k" + uint16; omitted fields take no space
+	require.Len(t, data, 1+1+2+2)
+
+	out := T{Secret: "mine", Note: "stale", Count: 5, Items: []int8{1}, Ptr: &Inner{1}}
+	require.NoError(t, f.Decode(data, &out))
+	require.Equal(t, T{Keep: "k", Secret: "mine", Present: 9}, out)
+
+	full := T{Keep: "k", Note: "n", Count: -1, Items: []int8{2}, Ptr: &Inner{3}, Present: 1}
+	data, err = f.Encode(full)
+	require.NoError(t, err)
+	var got T
+	require.NoError(t, f.Decode(data, &got))
+	require.Equal(t, full, got)
+}
+
+// Explicit ids fix the wire order independently of declaration order.
+func TestTags_FieldIDs(t *testing.T) {
+	type A struct {
+		X int32  `fractus:"id=1"`
+		Y string `fractus:"id=2"`
+		Z bool   `fractus:"id=5"`
+	}
+	type B struct {
+		Z bool   `fractus:"id=5"`
+		Y string `fractus:"id=2"`
+		X int32  `fractus:"id=1"`
+	}
+	f := NewFractus(SafeOptions{})
+	a := A{X: 7, Y: "y", Z: true}
+	da, err := f.Encode(a)
+	require.NoError(t, err)
+	da = append([]byte(nil), da...)
+	db, err := f.Encode(B{Z: true, Y: "y", X: 7})
+	require.NoError(t, err)
+	require.Equal(t, da, db)
+
+	var out B
+	require.NoError(t, f.Decode(da, &out))
+	require.Equal(t, B{Z: true, Y: "y", X: 7}, out)
+
+	plan, err := f.getPlan(reflect.TypeOf(B{}))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 5}, []int{plan.fields[0].id, plan.fields[1].id, plan.fields[2].id})
+}
+
+func TestTags_Invalid(t *testing.T) {
+	type Dup struct {
+		A int8
+		B int8 `fractus:"id=1"`
+	}
+	type BadID struct {
+		A int8 `fractus:"id=zero"`
+	}
+	type Unknown struct {
+		A int8 `fractus:",omitempt"`
+	}
+	type Nested struct {
+		Ok  int8
+		Bad Unknown
+	}
+	f := NewFractus(SafeOptions{})
+	for _, v := range []any{Dup{}, BadID{}, Unknown{}, Nested{}} {
+		_, err := f.Encode(v)
+		require.ErrorIs(t, err, ErrInvalidTag)
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	require.Empty(t, f.plan)
+}
+
+type evolveV1 struct {
+	A int32
+	B string
+}
+
+type evolveV2 struct {
+	A int32
+	B string
+	C []int16
+	D map[string]uint8
+}
+
+func TestSchemaEvolution_Compatible(t *testing.T) {
+	f := NewFractus(SafeOptions{Compatible: true})
+
+	// old reader, new payload: unknown trailing fields are skipped
+	data, err := f.Encode(evolveV2{A: 1, B: "b", C: []int16{1, 2}, D: map[string]uint8{"x": 1}})
+	require.NoError(t, err)
+	var old evolveV1
+	require.NoError(t, f.Decode(data, &old))
+	require.Equal(t, evolveV1{A: 1, B: "b"}, old)
+
+	// new reader, old payload: missing fields come back as zero values
+	data, err = f.Encode(evolveV1{A: 2, B: "c"})
+	require.NoError(t, err)
+	cur := evolveV2{C: []int16{9}, D: map[string]uint8{"stale": 1}}
+	require.NoError(t, f.Decode(data, &cur))
+	require.Equal(t, evolveV2{A: 2, B: "c"}, cur)
+}
+
+// Nested structs are length-prefixed, so trailing fields can be skipped at
+// any depth, including inside slices.
+func TestSchemaEvolution_Nested(t *testing.T) {
+	type OuterV1 struct {
+		X    evolveV1
+		List []evolveV1
+		Y    int8
+	}
+	type OuterV2 struct {
+		X    evolveV2
+		List []evolveV2
+		Y    int8
+	}
+	f := NewFractus(SafeOptions{Compatible: true})
+	v2 := OuterV2{
+		X:    evolveV2{A: 1, B: "x", C: []int16{3}},
+		List: []evolveV2{{A: 2, D: map[string]uint8{"k": 2}}, {B: "z"}},
+		Y:    -3,
+	}
+	data, err := f.Encode(v2)
+	require.NoError(t, err)
+	var v1 OuterV1
+	require.NoError(t, f.Decode(data, &v1))
+	require.Equal(t, OuterV1{X: evolveV1{A: 1, B: "x"}, List: []evolveV1{{A: 2}, {B: "z"}}, Y: -3}, v1)
+
+	data, err = f.Encode(v1)
+	require.NoError(t, err)
+	var back OuterV2
+	require.NoError(t, f.Decode(data, &back))
+	require.Equal(t, OuterV2{X: evolveV2{A: 1, B: "x"}, List: []evolveV2{{A: 2}, {B: "z"}}, Y: -3}, back)
+}
+
+func TestSchemaEvolution_StrictRejects(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(evolveV2{A: 1})
+	require.NoError(t, err)
+	err = f.Decode(data, &evolveV1{})
+	require.ErrorIs(t, err, ErrFieldCount)
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, -1, de.Field)
+}
+
+func TestSelfDescribing_RoundTrip(t *testing.T) {
+	type Inner struct {
+		N  int16
+		Ss []string
+	}
+	type T struct {
+		A   int32
+		B   string
+		C   Inner
+		D   []Inner
+		E   map[string]*Inner
+		F   [4]float32
+		G   *Inner `fractus:",omitempty"`
+		Bit bool
+	}
+	v := T{A: -1, B: "b", C: Inner{N: 2, Ss: []string{"x"}}, D: []Inner{{N: 3, Ss: []string{}}},
+		E: map[string]*Inner{"k": {N: 4, Ss: []string{"y"}}}, F: [4]float32{1, 2, 3, 4}, Bit: true}
+	for _, opts := range []SafeOptions{{SelfDescribing: true}, {SelfDescribing: true, UnsafeStrings: true, UnsafePrimitives: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(v)
+		require.NoError(t, err)
+		data = append([]byte(nil), data...)
+		out := T{G: &Inner{N: 1}}
+		require.NoError(t, f.Decode(data, &out))
+		require.Equal(t, v, out)
+
+		// every strict prefix fails cleanly
+		for i := 0; i < len(data); i++ {
+			require.Error(t, f.Decode(data[:i], &T{}), "prefix length %d", i)
+		}
+	}
+}
+
+// Fields are matched by id: reordered, removed, added and retyped fields are
+// tolerated.
+func TestSelfDescribing_ReorderedAndRemovedFields(t *testing.T) {
+	type Writer struct {
+		A int32  `fractus:"id=1"`
+		B string `fractus:"id=2"`
+		C uint64 `fractus:"id=3"`
+		D []byte `fractus:"id=4"`
+	}
+	type Reader struct {
+		D   []byte `fractus:"id=4"`
+		New int8   `fractus:"id=9"`
+		A   int32  `fractus:"id=1"`
+		C   int16  `fractus:"id=3"` // retyped: skipped
+	}
+	f := NewFractus(SafeOptions{SelfDescribing: true})
+	data, err := f.Encode(Writer{A: 5, B: "gone", C: 7, D: []byte{1, 2}})
+	require.NoError(t, err)
+	out := Reader{New: 3, C: 9}
+	require.NoError(t, f.Decode(data, &out))
+	require.Equal(t, Reader{D: []byte{1, 2}, A: 5}, out)
+}
+
+func TestReadFields_NoSchema(t *testing.T) {
+	type Inner struct{ X uint8 }
+	type T struct {
+		A int32
+		S string
+		I Inner
+		L []uint16
+	}
+	f := NewFractus(SafeOptions{SelfDescribing: true})
+	data, err := f.Encode(T{A: 1, S: "hi", I: Inner{X: 9}, L: []uint16{7}})
+	require.NoError(t, err)
+	fields, err := ReadFields(data)
+	require.NoError(t, err)
+	require.Len(t, fields, 4)
+	require.Equal(t, RawField{ID: 1, Wire: WireFixed4, Value: []byte{1, 0, 0, 0}}, fields[0])
+	require.Equal(t, RawField{ID: 2, Wire: WireBytes, Value: []byte("hi")}, fields[1])
+	require.Equal(t, WireBytes, fields[2].Wire)
+	inner, err := ReadFields(fields[2].Value)
+	require.NoError(t, err)
+	require.Equal(t, []RawField{{ID: 1, Wire: WireFixed1, Value: []byte{9}}}, inner)
+	require.Equal(t, RawField{ID: 4, Wire: WireBytes, Value: []byte{1, 7, 0}}, fields[3])
+	require.Equal(t, "fixed4", fields[0].Wire.String())
+}
+
+// decimal encodes itself as text; its fields are unexported so reflection
+// alone could not encode it.
+type decimal struct {
+	units int64
+	scale uint8
+}
+
+func (d decimal) MarshalFractus(dst []byte) []byte {
+	return fmt.Appendf(dst, "%d/%d", d.units, d.scale)
+}
+
+func (d *decimal) UnmarshalFractus(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d/%d", &d.units, &d.scale)
+	return err
+}
+
+type ledger struct {
+	Total   decimal
+	Lines   []decimal
+	ByName  map[string]decimal
+	Pending *decimal
+	Note    string
+}
+
+func TestMarshaler_RoundTrip(t *testing.T) {
+	in := ledger{
+		Total:   decimal{1250, 2},
+		Lines:   []decimal{{1000, 2}, {-250, 2}},
+		ByName:  map[string]decimal{"fee": {5, 1}},
+		Pending: &decimal{7, 0},
+		Note:    "march",
+	}
+	for _, opts := range []SafeOptions{{}, {SelfDescribing: true}, {Compatible: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(in)
+		require.NoError(t, err)
+		var out ledger
+		require.NoError(t, f.Decode(data, &out))
+		assert.Equal(t, in, out, "%+v", opts)
+	}
+}
+
+func TestMarshaler_Payload(t *testing.T) {
+	type wrapper struct{ D decimal }
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(wrapper{decimal{12, 2}})
+	require.NoError(t, err)
+	// field count, payload length, payload
+	assert.Equal(t, []byte{1, 4, '1', '2', '/', '2'}, data)
+
+	// at the top level the payload is the whole message
+	data, err = f.Encode(decimal{5, 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("5/1"), data)
+	var d decimal
+	require.NoError(t, f.Decode(data, &d))
+	assert.Equal(t, decimal{5, 1}, d)
+}
+
+type marshalOnly struct{}
+
+func (marshalOnly) MarshalFractus(dst []byte) []byte { return dst }
+
+// failing reports a decode error relative to its own payload.
+type failing struct{}
+
+func (failing) MarshalFractus(dst []byte) []byte { return append(dst, 0, 0, 0) }
+
+func (*failing) UnmarshalFractus(b []byte) error {
+	return &DecodeError{Offset: 2, Field: 0, Err: ErrTruncated}
+}
+
+func TestMarshaler_Errors(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	_, err := f.Encode(struct{ M marshalOnly }{})
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	type withFailing struct {
+		A int8
+		F failing
+	}
+	data, err := f.Encode(withFailing{})
+	require.NoError(t, err)
+	var out withFailing
+	err = f.Decode(data, &out)
+	var de *DecodeError
+	require.ErrorAs(t, err, &de)
+	// count + A + length prefix, then the offset inside the payload
+	assert.Equal(t, 3+2, de.Offset)
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+type peer struct {
+	Addr    netip.Addr
+	Subnets []netip.Prefix
+	Stake   *big.Int
+	Debt    big.Int
+}
+
+func newPeerCodecs(opts SafeOptions) *Fractus {
+	f := NewFractus(opts)
+	f.RegisterCodec(reflect.TypeFor[netip.Addr](), plugins.EncodeBinary, plugins.DecodeBinary)
+	f.RegisterCodec(reflect.TypeFor[netip.Prefix](), plugins.EncodeText, plugins.DecodeText)
+	f.RegisterCodec(reflect.TypeFor[big.Int](), plugins.EncodeBigInt, plugins.DecodeBigInt)
+	return f
+}
+
+func TestRegisterCodec_RoundTrip(t *testing.T) {
+	stake, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	in := peer{
+		Addr:    netip.MustParseAddr("2001:db8::1"),
+		Subnets: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+		Stake:   stake,
+	}
+	in.Debt.SetInt64(-42)
+	for _, opts := range []SafeOptions{{}, {SelfDescribing: true}} {
+		f := newPeerCodecs(opts)
+		data, err := f.Encode(&in)
+		require.NoError(t, err)
+		var out peer
+		require.NoError(t, f.Decode(data, &out))
+		assert.Equal(t, in.Addr, out.Addr)
+		assert.Equal(t, in.Subnets, out.Subnets)
+		assert.Zero(t, in.Stake.Cmp(out.Stake))
+		assert.Zero(t, in.Debt.Cmp(&out.Debt))
+	}
+
+	// codecs are scoped to the instance they were registered on: without
+	// them the unexported internals of netip.Addr are silently skipped
+	plain := NewFractus(SafeOptions{})
+	data, err := plain.Encode(peer{Addr: in.Addr})
+	require.NoError(t, err)
+	var out peer
+	require.NoError(t, plain.Decode(data, &out))
+	assert.False(t, out.Addr.IsValid())
+}
+
+func TestRegisterCodec_CodecAndStream(t *testing.T) {
+	in := peer{Addr: netip.MustParseAddr("2001:db8::1"), Stake: big.NewInt(7)}
+	f := newPeerCodecs(SafeOptions{})
+	want, err := f.Encode(&in)
+	require.NoError(t, err)
+
+	c, err := NewCodecFor[peer](f)
+	require.NoError(t, err)
+	data, err := c.Marshal(&in)
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+	var out peer
+	require.NoError(t, c.Unmarshal(data, &out))
+	assert.Equal(t, in.Addr, out.Addr)
+	assert.Zero(t, in.Stake.Cmp(out.Stake))
+
+	var conn bytes.Buffer
+	require.NoError(t, f.NewEncoder(&conn).Encode(&in))
+	assert.Equal(t, append(writeVarUint(nil, uint64(len(want))), want...), conn.Bytes())
+	out = peer{}
+	require.NoError(t, f.NewDecoder(&conn).Decode(&out))
+	assert.Equal(t, in.Addr, out.Addr)
+	assert.Zero(t, in.Stake.Cmp(out.Stake))
+}
+
+func TestRegisterCodec_Precedence(t *testing.T) {
+	type wrapper struct{ D decimal }
+	f := NewFractus(SafeOptions{})
+	before, err := f.Encode(wrapper{decimal{1, 0}})
+	require.NoError(t, err)
+	before = append([]byte(nil), before...)
+
+	// registering replaces the Marshaler and invalidates cached plans
+	f.RegisterCodec(reflect.TypeFor[decimal](),
+		func(dst []byte, v reflect.Value) ([]byte, error) {
+			return append(dst, byte(v.Interface().(decimal).units)), nil
+		},
+		func(b []byte, v reflect.Value) error {
+			v.Set(reflect.ValueOf(decimal{units: int64(b[0])}))
+			return nil
+		})
+	after, err := f.Encode(wrapper{decimal{1, 0}})
+	require.NoError(t, err)
+	assert.NotEqual(t, before, after)
+	assert.Equal(t, []byte{1, 1, 1}, after)
+
+	boom := errors.New("boom")
+	f.RegisterCodec(reflect.TypeFor[decimal](),
+		func([]byte, reflect.Value) ([]byte, error) { return nil, boom },
+		func([]byte, reflect.Value) error { return boom })
+	_, err = f.Encode(wrapper{})
+	assert.ErrorIs(t, err, boom)
+	err = f.Decode(after, &wrapper{})
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestRegisterCodec_TopLevelAfterUse(t *testing.T) {
+	type point struct{ X, Y int8 }
+	f := NewFractus(SafeOptions{})
+	before, err := f.Encode(point{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{2, 1, 2}, before)
+
+	// the cached classification of point must not outlive the registration
+	f.RegisterCodec(reflect.TypeFor[point](),
+		func(dst []byte, v reflect.Value) ([]byte, error) {
+			p := v.Interface().(point)
+			return append(dst, byte(p.X), byte(p.Y)), nil
+		},
+		func(b []byte, v reflect.Value) error {
+			v.Set(reflect.ValueOf(point{int8(b[0]), int8(b[1])}))
+			return nil
+		})
+	after, err := f.Encode(point{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, after)
+
+	var out point
+	require.NoError(t, f.Decode(after, &out))
+	assert.Equal(t, point{1, 2}, out)
+}
+
+type event struct {
+	At        time.Time
+	Never     time.Time
+	Took      time.Duration
+	Deadlines []time.Time
+	Cancelled *time.Time
+}
+
+func TestRoundTrip_Times(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	in := event{
+		At:        time.Date(2024, 3, 1, 12, 30, 0, 123456789, ist),
+		Took:      1500 * time.Millisecond,
+		Deadlines: []time.Time{time.Unix(0, 0).UTC(), time.Now()},
+		Cancelled: &time.Time{},
+	}
+	for _, opts := range []SafeOptions{{}, {SelfDescribing: true}, {UTCTimes: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(in)
+		require.NoError(t, err)
+		var out event
+		require.NoError(t, f.Decode(data, &out))
+
+		assert.True(t, in.At.Equal(out.At), "%+v", opts)
+		_, offset := out.At.Zone()
+		if opts.UTCTimes {
+			assert.Equal(t, time.UTC, out.At.Location())
+		} else {
+			assert.Equal(t, 5*3600+1800, offset)
+		}
+		assert.True(t, out.Never.IsZero())
+		assert.Equal(t, in.Took, out.Took)
+		require.Len(t, out.Deadlines, 2)
+		for i := range in.Deadlines {
+			assert.True(t, in.Deadlines[i].Equal(out.Deadlines[i]))
+		}
+		require.NotNil(t, out.Cancelled)
+		assert.True(t, out.Cancelled.IsZero())
+	}
+}
+
+func TestEncode_TimeLayout(t *testing.T) {
+	type stamp struct{ At time.Time }
+	f := NewFractus(SafeOptions{})
+	// the zero time is an empty payload
+	data, err := f.Encode(stamp{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0}, data)
+
+	data, err = f.Encode(stamp{time.Unix(0, 258).UTC()})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 8, 2, 1, 0, 0, 0, 0, 0, 0}, data)
+
+	_, err = f.Encode(stamp{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	var out stamp
+	err = f.Decode([]byte{1, 3, 1, 2, 3}, &out)
+	assert.ErrorIs(t, err, ErrInvalidTime)
+}
+
+func TestCodec_MatchesEncode(t *testing.T) {
+	c, err := NewCodec[ledger](SafeOptions{})
+	require.NoError(t, err)
+	in := ledger{Total: decimal{3, 1}, Lines: []decimal{{1, 0}}, Note: "n"}
+
+	data, err := c.Marshal(&in)
+	require.NoError(t, err)
+	want, err := NewFractus(SafeOptions{}).Encode(in)
+	require.NoError(t, err)
+	assert.Equal(t, want, data)
+
+	// AppendMarshal keeps the caller's prefix and Marshal results are not
+	// reused by later calls
+	framed, err := c.AppendMarshal([]byte{0xaa}, &in)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0xaa}, want...), framed)
+	assert.Equal(t, want, data)
+
+	var out ledger
+	require.NoError(t, c.Unmarshal(data, &out))
+	assert.Equal(t, in.Total, out.Total)
+	assert.Equal(t, in.Lines, out.Lines)
+	assert.Equal(t, in.Note, out.Note)
+
+	var de *DecodeError
+	assert.ErrorAs(t, c.Unmarshal(data[:2], &out), &de)
+	_, err = c.Marshal(nil)
+	assert.ErrorIs(t, err, ErrNotStructPtr)
+}
+
+func TestCodec_CustomAndBuiltin(t *testing.T) {
+	dc, err := NewCodec[decimal](SafeOptions{})
+	require.NoError(t, err)
+	data, err := dc.Marshal(&decimal{5, 1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("5/1"), data)
+	var d decimal
+	require.NoError(t, dc.Unmarshal(data, &d))
+	assert.Equal(t, decimal{5, 1}, d)
+
+	tc, err := NewCodec[time.Time](SafeOptions{UTCTimes: true})
+	require.NoError(t, err)
+	now := time.Now()
+	data, err = tc.Marshal(&now)
+	require.NoError(t, err)
+	var got time.Time
+	require.NoError(t, tc.Unmarshal(data, &got))
+	assert.True(t, now.Equal(got))
+}
+
+func TestCodec_FailsFast(t *testing.T) {
+	_, err := NewCodec[int](SafeOptions{})
+	assert.ErrorIs(t, err, ErrNotStruct)
+	_, err = NewCodec[struct{ C chan int }](SafeOptions{})
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = NewCodec[struct{ M marshalOnly }](SafeOptions{})
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestAppendEncode_CallerOwnedStorage(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	a, err := f.AppendEncode(nil, MixedStruct{Str: "first", Int32: 1})
+	require.NoError(t, err)
+	b, err := f.AppendEncode(nil, MixedStruct{Str: "second", Int32: 2})
+	require.NoError(t, err)
+	want, err := f.Encode(MixedStruct{Str: "first", Int32: 1})
+	require.NoError(t, err)
+	assert.Equal(t, want, a, "a later call must not overwrite an earlier result")
+	assert.NotEqual(t, a, b)
+
+	// appends after the caller's frame header, without allocating when
+	// the buffer is large enough
+	frame := make([]byte, 2, 256)
+	frame, err = f.AppendEncode(frame, MixedStruct{Str: "first", Int32: 1})
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0, 0}, want...), frame)
+	v := &MixedStruct{Str: "first"}
+	allocs := testing.AllocsPerRun(100, func() {
+		frame, _ = f.AppendEncode(frame[:2], v)
+	})
+	assert.Zero(t, allocs)
+
+	out, err := f.AppendEncode(frame[:2], 42)
+	assert.ErrorIs(t, err, ErrNotStruct)
+	assert.Len(t, out, 2)
+}
+
+func TestFractus_ConcurrentUse(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	const workers, rounds = 8, 200
+	results := make([][][]byte, workers)
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				in := MixedStruct{Str: fmt.Sprintf("w%d-%d", w, i), Int32: int32(i), Float64: float64(w)}
+				data, err := f.Encode(&in)
+				if !assert.NoError(t, err) {
+					return
+				}
+				var out MixedStruct
+				if !assert.NoError(t, f.Decode(data, &out)) || !assert.Equal(t, in, out) {
+					return
+				}
+				results[w] = append(results[w], data)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// results handed out earlier, on any goroutine, are never overwritten
+	for w, rs := range results {
+		for i, data := range rs {
+			var out MixedStruct
+			require.NoError(t, f.Decode(data, &out))
+			require.Equal(t, fmt.Sprintf("w%d-%d", w, i), out.Str)
+		}
+	}
+}
+
+func TestStream_RoundTrip(t *testing.T) {
+	var conn bytes.Buffer
+	enc := NewEncoder(&conn, SafeOptions{})
+	in := []MixedStruct{{Str: "first", Int8: 1}, {}, {Str: strings.Repeat("x", 300), Uint64: 7}}
+	for i := range in {
+		require.NoError(t, enc.Encode(&in[i]))
+	}
+	require.ErrorIs(t, enc.Encode(42), ErrNotStruct)
+
+	// each frame is the varint payload length followed by the payload
+	f := NewFractus(SafeOptions{})
+	payload, err := f.Encode(in[2])
+	require.NoError(t, err)
+	frames := conn.Bytes()
+	last := append(writeVarUint(nil, uint64(len(payload))), payload...)
+	assert.Equal(t, last, frames[len(frames)-len(last):])
+
+	// an io.Reader without ReadByte is buffered by the decoder
+	dec := NewDecoder(io.MultiReader(&conn), SafeOptions{UnsafeStrings: true})
+	for i := range in {
+		var out MixedStruct
+		require.NoError(t, dec.Decode(&out))
+		assert.Equal(t, in[i], out)
+	}
+	var out MixedStruct
+	assert.Equal(t, io.EOF, dec.Decode(&out))
+}
+
+func TestStream_DropsLargeBuffers(t *testing.T) {
+	var conn bytes.Buffer
+	enc := NewEncoder(&conn, SafeOptions{})
+	in := []MixedStruct{{Str: "small"}, {Str: strings.Repeat("x", 2*maxScratch)}, {Str: "again"}}
+	caps := make([]int, len(in))
+	for i := range in {
+		require.NoError(t, enc.Encode(&in[i]))
+		caps[i] = cap(enc.buf)
+	}
+	assert.NotZero(t, caps[0], "small frames reuse the buffer")
+	assert.Zero(t, caps[1], "a large frame does not stay pinned")
+	assert.LessOrEqual(t, caps[2], maxScratch)
+
+	dec := NewDecoder(&conn, SafeOptions{})
+	for i := range in {
+		var out MixedStruct
+		require.NoError(t, dec.Decode(&out))
+		assert.Equal(t, in[i], out)
+		assert.LessOrEqual(t, cap(dec.buf), maxScratch)
+	}
+}
+
+func TestStream_Errors(t *testing.T) {
+	var conn bytes.Buffer
+	require.NoError(t, NewEncoder(&conn, SafeOptions{}).Encode(MixedStruct{Str: "cut"}))
+	frame := conn.Bytes()
+
+	var out MixedStruct
+	for _, n := range []int{1, len(frame) - 1} {
+		err := NewDecoder(bytes.NewReader(frame[:n]), SafeOptions{}).Decode(&out)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "cut at %d", n)
+	}
+
+	huge := writeVarUint(nil, MaxFrameSize+1)
+	err := NewDecoder(bytes.NewReader(huge), SafeOptions{}).Decode(&out)
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	overflow := bytes.Repeat([]byte{0xFF}, maxVarintLen64+1)
+	err = NewDecoder(bytes.NewReader(overflow), SafeOptions{}).Decode(&out)
+	assert.ErrorIs(t, err, ErrVarintOverflow)
+
+	// payload errors keep their offsets within the frame
+	bad := append(writeVarUint(nil, 1), 5)
+	var de *DecodeError
+	err = NewDecoder(bytes.NewReader(bad), SafeOptions{}).Decode(&out)
+	require.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrFieldCount)
+}
+
+type record struct {
+	ID     int64
+	Name   string
+	Tags   []string
+	Ratio  float32
+	Small  int8 `fractus:",omitempty"`
+	Blob   []byte
+	Next   *record
+	Flags  map[string]uint16
+	Active bool
+	Count  uint32
+	secret int
+}
+
+func TestView_Fields(t *testing.T) {
+	in := record{
+		ID: -42, Name: "alpha", Tags: []string{"a", "bb"}, Ratio: 1.5,
+		Blob: []byte{1, 2, 3}, Next: &record{Name: "beta"},
+		Flags: map[string]uint16{"x": 1, "y": 2}, Active: true, Count: 9,
+	}
+	for name, opts := range map[string]SafeOptions{
+		"compact":     {},
+		"table":       {OffsetTable: true},
+		"tagged":      {SelfDescribing: true},
+		"compatible":  {Compatible: true, OffsetTable: true},
+		"unsafeslice": {UnsafePrimitives: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := NewFractus(opts)
+			data, err := f.Encode(&in)
+			require.NoError(t, err)
+			var out record
+			require.NoError(t, f.Decode(data, &out), "Decode ignores the offset table")
+
+			v, err := f.NewView(data, reflect.TypeFor[record]())
+			require.NoError(t, err)
+			// out of order, so cached walks restart
+			count, err := v.Uint64(9)
+			require.NoError(t, err)
+			assert.EqualValues(t, 9, count)
+			id, err := v.Int64(0)
+			require.NoError(t, err)
+			assert.EqualValues(t, -42, id)
+			s, err := v.String(1)
+			require.NoError(t, err)
+			assert.Equal(t, "alpha", s)
+			ratio, err := v.Float64(3)
+			require.NoError(t, err)
+			assert.EqualValues(t, 1.5, ratio)
+			small, err := v.Int64(4)
+			require.NoError(t, err, "omitted fields read as zero")
+			assert.Zero(t, small)
+			blob, err := v.Bytes(5)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{1, 2, 3}, blob)
+			active, err := v.Bool(8)
+			require.NoError(t, err)
+			assert.True(t, active)
+
+			_, err = v.String(0)
+			assert.ErrorIs(t, err, ErrKindMismatch)
+			_, err = v.Int64(10)
+			assert.ErrorIs(t, err, ErrUnknownField)
+			_, err = v.Int64(99)
+			assert.ErrorIs(t, err, ErrUnknownField)
+		})
+	}
+}
+
+func TestView_OffsetTableLayout(t *testing.T) {
+	in := MixedStruct{Str: "abc", Int8: 5}
+	plain, err := NewFractus(SafeOptions{}).Encode(in)
+	require.NoError(t, err)
+	data, err := NewFractus(SafeOptions{OffsetTable: true}).Encode(in)
+	require.NoError(t, err)
+
+	// the payload is unchanged, followed by one uint32 offset per field
+	// and the number of fields
+	require.Equal(t, plain, data[:len(plain)])
+	table := data[len(plain):]
+	require.Len(t, table, 4*12)
+	assert.EqualValues(t, 1, binary.LittleEndian.Uint32(table), "Str follows the field count")
+	assert.EqualValues(t, 5, binary.LittleEndian.Uint32(table[4:]), "Int8 follows Str")
+	assert.EqualValues(t, 11, binary.LittleEndian.Uint32(table[44:]))
+
+	c, err := NewCodec[MixedStruct](SafeOptions{OffsetTable: true})
+	require.NoError(t, err)
+	typed, err := c.Marshal(&in)
+	require.NoError(t, err)
+	assert.Equal(t, data, typed)
+}
+
+func TestView_Errors(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(record{Name: "alpha", Count: 3})
+	require.NoError(t, err)
+
+	var de *DecodeError
+	v, err := f.NewView(data[:len(data)-2], reflect.TypeFor[record]())
+	require.NoError(t, err, "fields are only checked when read")
+	_, err = v.Uint64(9)
+	require.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.Equal(t, 9, de.Field)
+
+	_, err = f.NewView(data, reflect.TypeFor[MixedStruct]())
+	assert.ErrorIs(t, err, ErrFieldCount)
+	_, err = f.NewView(data, reflect.TypeFor[decimal]())
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = NewFractus(SafeOptions{OffsetTable: true}).NewView(data[:3], reflect.TypeFor[record]())
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestView_NoAllocs(t *testing.T) {
+	typ := reflect.TypeFor[record]()
+	// payloads past 32 bytes, where a string conversion would reach the heap
+	long := record{ID: 7, Name: strings.Repeat("alpha", 16), Tags: []string{"a", "b"}, Count: 3}
+	for _, opts := range []SafeOptions{{}, {Checksum: true}, {Envelope: true, OffsetTable: true}} {
+		f := NewFractus(opts)
+		for _, in := range []record{{ID: 7, Name: "alpha", Tags: []string{"a"}, Count: 3}, long} {
+			data, err := f.Encode(in)
+			require.NoError(t, err)
+			allocs := testing.AllocsPerRun(100, func() {
+				v, _ := f.NewView(data, typ)
+				_, _ = v.Uint64(9)
+				_, _ = v.String(1)
+			})
+			assert.Zero(t, allocs, "%+v, %d bytes", opts, len(data))
+		}
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	in := record{
+		ID: 7, Name: "alpha", Tags: []string{"a", "bb"}, Blob: []byte{1},
+		Next: &record{Name: "beta"}, Flags: map[string]uint16{"x": 1}, Count: 9,
+	}
+	for name, opts := range map[string]SafeOptions{
+		"compact": {},
+		"tagged":  {SelfDescribing: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := NewFractus(opts)
+			data, err := f.Encode(&in)
+			require.NoError(t, err)
+
+			out := record{ID: -1, Name: "stale", Small: 3, Active: true}
+			require.NoError(t, f.DecodeFields(data, &out, "Count", "Name", "Small"))
+			assert.Equal(t, record{ID: -1, Name: "alpha", Active: true, Count: 9}, out,
+				"other fields are untouched, omitted ones zeroed")
+
+			err = f.DecodeFields(data, &out, "Name", "Missing")
+			assert.ErrorIs(t, err, ErrUnknownField)
+			assert.Equal(t, "alpha", out.Name)
+			assert.ErrorIs(t, f.DecodeFields(data, out, "Name"), ErrNotStructPtr)
+		})
+	}
+}
+
+func TestDecodeFields_StopsEarly(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(MixedStruct{Str: "head", Int8: 4, Float64: 2})
+	require.NoError(t, err)
+
+	// nothing past Int8 is read
+	var out MixedStruct
+	require.NoError(t, f.DecodeFields(data[:7], &out, "Int8", "Str"))
+	assert.Equal(t, MixedStruct{Str: "head", Int8: 4}, out)
+
+	// a repeated name is one field to read, not two
+	out = MixedStruct{}
+	require.NoError(t, f.DecodeFields(data[:7], &out, "Int8", "Str", "Int8"))
+	assert.Equal(t, MixedStruct{Str: "head", Int8: 4}, out)
+
+	var de *DecodeError
+	err = f.DecodeFields(data[:7], &out, "Float64")
+	require.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestSize_MatchesEncode(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("x", 3600))
+	values := []any{
+		MixedStruct{Str: strings.Repeat("s", 200), Int32: -1},
+		&record{Name: "alpha", Tags: []string{"a", ""}, Blob: make([]byte, 130),
+			Next: &record{Small: 2}, Flags: map[string]uint16{"x": 1, "yy": 2}},
+		record{},
+		ledger{Total: decimal{12345, 2}, Lines: []decimal{{1, 0}}, ByName: map[string]decimal{"a": {}}},
+		decimal{7, 1},
+		event{At: at, Deadlines: []time.Time{at.UTC(), {}}, Cancelled: &at},
+		at,
+	}
+	for _, opts := range []SafeOptions{
+		{}, {SelfDescribing: true}, {OffsetTable: true}, {UTCTimes: true},
+		{UnsafePrimitives: true, UnsafeStrings: true},
+	} {
+		f := NewFractus(opts)
+		for _, v := range values {
+			data, err := f.Encode(v)
+			require.NoError(t, err)
+			size, err := f.Size(v)
+			require.NoError(t, err)
+			assert.Equal(t, len(data), size, "%+v %T", opts, v)
+		}
+	}
+
+	f := newPeerCodecs(SafeOptions{})
+	p := peer{Addr: netip.MustParseAddr("10.0.0.1"), Stake: big.NewInt(-5)}
+	data, err := f.Encode(&p)
+	require.NoError(t, err)
+	size, err := f.Size(&p)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), size)
+
+	_, err = f.Size(42)
+	assert.ErrorIs(t, err, ErrNotStruct)
+
+	c, err := NewCodec[record](SafeOptions{})
+	require.NoError(t, err)
+	r := values[1].(*record)
+	data, err = c.Marshal(r)
+	require.NoError(t, err)
+	size, err = c.Size(r)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), size)
+	assert.Equal(t, size, cap(data), "Marshal allocates the exact size")
+}
+
+func TestEncode_AllocatesOnce(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	// larger than a chunk, so the result gets its own allocation
+	v := &MixedStruct{Str: strings.Repeat("x", 3*chunkSize)}
+	if !raceEnabled {
+		allocs := testing.AllocsPerRun(20, func() {
+			_, _ = f.Encode(v)
+		})
+		assert.Equal(t, 1.0, allocs)
+	}
+
+	out, err := f.AppendEncode(nil, v)
+	require.NoError(t, err)
+	size, err := f.Size(v)
+	require.NoError(t, err)
+	assert.Len(t, out, size)
+}
+
+func TestEncode_ExactResults(t *testing.T) {
+	// past the tiny allocator, which packs small allocations together, and
+	// not a multiple of a size class
+	type small struct{ S string }
+	one, two := small{strings.Repeat("a", 20)}, small{strings.Repeat("b", 20)}
+	// adjacent reports whether b starts right where a ends, as it does
+	// when both were carved from one chunk
+	adjacent := func(a, b []byte) bool {
+		return reflect.ValueOf(a).Pointer()+uintptr(len(a)) == reflect.ValueOf(b).Pointer()
+	}
+
+	f := NewFractus(SafeOptions{})
+	a, err := f.Encode(one)
+	require.NoError(t, err)
+	b, err := f.Encode(two)
+	require.NoError(t, err)
+	require.NotZero(t, len(a)%8)
+	assert.True(t, adjacent(a, b), "small results share a chunk by default")
+
+	f = NewFractus(SafeOptions{ExactResults: true})
+	for range 3 {
+		a, err = f.Encode(one)
+		require.NoError(t, err)
+		b, err = f.Encode(two)
+		require.NoError(t, err)
+		assert.False(t, adjacent(a, b))
+		assert.Equal(t, len(a), cap(a))
+	}
+	var got small
+	require.NoError(t, f.Decode(b, &got))
+	assert.Equal(t, two, got)
+}
+
+func TestEncode_EncodesFieldsOnce(t *testing.T) {
+	type wrapper struct {
+		D    decimal
+		Note string
+	}
+	calls := 0
+	f := NewFractus(SafeOptions{})
+	f.RegisterCodec(reflect.TypeFor[decimal](),
+		func(dst []byte, v reflect.Value) ([]byte, error) {
+			calls++
+			return append(dst, byte(v.Interface().(decimal).units)), nil
+		},
+		func(b []byte, v reflect.Value) error { return nil })
+	c, err := NewCodecFor[wrapper](f)
+	require.NoError(t, err)
+	in := wrapper{D: decimal{units: 5}, Note: "n"}
+
+	// results are not measured before they are written
+	encodes := map[string]func() ([]byte, error){
+		"Encode":       func() ([]byte, error) { return f.Encode(&in) },
+		"AppendEncode": func() ([]byte, error) { return f.AppendEncode(nil, &in) },
+		"Marshal":      func() ([]byte, error) { return c.Marshal(&in) },
+	}
+	for name, encode := range encodes {
+		calls = 0
+		out, err := encode()
+		require.NoError(t, err)
+		assert.Equal(t, []byte{2, 1, 5, 1, 'n'}, out, name)
+		assert.Equal(t, 1, calls, name)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	in := record{
+		Name: "alpha", Tags: []string{"a", "b", "c"}, Blob: []byte{1, 2},
+		Flags: map[string]uint16{"x": 1, "y": 2},
+	}
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(&in)
+	require.NoError(t, err)
+	bigMap, err := f.Encode(&record{Flags: map[string]uint16{"x": 1, "y": 2, "z": 3}})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name    string
+		payload []byte
+		limits  DecodeLimits
+		field   int
+	}{
+		{"bytes", data, DecodeLimits{MaxBytes: len(data) - 1}, -1},
+		{"slice", data, DecodeLimits{MaxElems: 2}, 2},
+		{"map", bigMap, DecodeLimits{MaxElems: 2}, 7},
+		{"string", data, DecodeLimits{MaxString: 4}, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out record
+			err := NewFractus(SafeOptions{Limits: c.limits}).Decode(c.payload, &out)
+			var de *DecodeError
+			require.ErrorAs(t, err, &de)
+			assert.ErrorIs(t, err, ErrLimitExceeded)
+			assert.Equal(t, c.field, de.Field)
+		})
+	}
+
+	// limits at exactly the payload's needs pass
+	exact := DecodeLimits{MaxBytes: len(data), MaxElems: 3, MaxString: 5, MaxDepth: 1}
+	var out record
+	require.NoError(t, NewFractus(SafeOptions{Limits: exact}).Decode(data, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestDecodeLimits_Depth(t *testing.T) {
+	chain := &record{Name: "leaf"}
+	for range 100 {
+		chain = &record{Next: chain}
+	}
+	data, err := NewFractus(SafeOptions{}).Encode(chain)
+	require.NoError(t, err)
+
+	f := NewFractus(SafeOptions{Limits: DecodeLimits{MaxDepth: 20}})
+	var out record
+	assert.ErrorIs(t, f.Decode(data, &out), ErrLimitExceeded)
+	assert.ErrorIs(t, f.DecodeFields(data, &out, "Next"), ErrLimitExceeded)
+	c, err := NewCodec[record](f.Opts)
+	require.NoError(t, err)
+	assert.ErrorIs(t, c.Unmarshal(data, &out), ErrLimitExceeded)
+
+	// each level is a pointer and a struct
+	shallow, err := NewFractus(SafeOptions{}).Encode(&record{Next: &record{}})
+	require.NoError(t, err)
+	for depth, ok := range map[int]bool{2: false, 3: true} {
+		f := NewFractus(SafeOptions{Limits: DecodeLimits{MaxDepth: depth}})
+		err := f.Decode(shallow, &out)
+		assert.Equal(t, ok, err == nil, "MaxDepth %d: %v", depth, err)
+	}
+}
+
+func TestDecodeLimits_DefaultDepth(t *testing.T) {
+	type node struct{ Next *node }
+	// each node is two levels deep, a pointer and a struct
+	var chain *node
+	for range DefaultMaxDepth / 2 {
+		chain = &node{Next: chain}
+	}
+	f := NewFractus(SafeOptions{})
+	data, err := f.Encode(chain)
+	require.NoError(t, err)
+	var out node
+	require.NoError(t, f.Decode(data, &out))
+
+	data, err = f.Encode(&node{Next: chain})
+	require.NoError(t, err)
+	assert.ErrorIs(t, f.Decode(data, &out), ErrLimitExceeded)
+	c, err := NewCodec[node](SafeOptions{})
+	require.NoError(t, err)
+	assert.ErrorIs(t, c.Unmarshal(data, &out), ErrLimitExceeded)
+
+	// an explicit MaxDepth replaces the default
+	deep := NewFractus(SafeOptions{Limits: DecodeLimits{MaxDepth: DefaultMaxDepth + 2}})
+	require.NoError(t, deep.Decode(data, &out))
+}
+
+func TestStream_MaxBytes(t *testing.T) {
+	var conn bytes.Buffer
+	enc := NewEncoder(&conn, SafeOptions{})
+	require.NoError(t, enc.Encode(MixedStruct{Str: "short"}))
+	require.NoError(t, enc.Encode(MixedStruct{Str: strings.Repeat("long", 20)}))
+
+	dec := NewDecoder(&conn, SafeOptions{Limits: DecodeLimits{MaxBytes: 64}})
+	var out MixedStruct
+	require.NoError(t, dec.Decode(&out))
+	assert.ErrorIs(t, dec.Decode(&out), ErrFrameTooLarge)
+}
+
+func TestChecksum_RoundTrip(t *testing.T) {
+	in := record{
+		ID: 7, Name: "alpha", Tags: []string{"a"}, Blob: []byte{1},
+		Flags: map[string]uint16{"x": 1}, Active: true, Count: 4,
+	}
+	plain, err := NewFractus(SafeOptions{}).Encode(&in)
+	require.NoError(t, err)
+	plain = append([]byte(nil), plain...)
+
+	for _, opts := range []SafeOptions{{Checksum: true}, {Checksum: true, OffsetTable: true}, {Checksum: true, SelfDescribing: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(&in)
+		require.NoError(t, err)
+		assert.Equal(t, checksumMarker, string(data[:2]), "%+v", opts)
+		size, err := f.Size(&in)
+		require.NoError(t, err)
+		assert.Equal(t, len(data), size, "%+v", opts)
+
+		var out record
+		require.NoError(t, f.Decode(data, &out), "%+v", opts)
+		assert.Equal(t, in, out, "%+v", opts)
+
+		view, err := f.NewView(data, reflect.TypeFor[record]())
+		require.NoError(t, err, "%+v", opts)
+		count, err := view.Uint64(9)
+		require.NoError(t, err)
+		name, err := view.String(1)
+		require.NoError(t, err)
+		assert.Equal(t, "alpha", name, "%+v", opts)
+		assert.Equal(t, uint64(in.Count), count, "%+v", opts)
+
+		var part record
+		require.NoError(t, f.DecodeFields(data, &part, "Tags"), "%+v", opts)
+		assert.Equal(t, in.Tags, part.Tags, "%+v", opts)
+	}
+
+	// checksummed and plain payloads coexist: either reader takes both
+	withSum, err := NewFractus(SafeOptions{Checksum: true}).Encode(&in)
+	require.NoError(t, err)
+	assert.Len(t, withSum, len(plain)+len(checksumMarker)+checksumLen)
+	for _, f := range []*Fractus{NewFractus(SafeOptions{}), NewFractus(SafeOptions{Checksum: true})} {
+		for _, data := range [][]byte{plain, withSum} {
+			var out record
+			require.NoError(t, f.Decode(data, &out))
+			assert.Equal(t, in, out)
+		}
+	}
+
+	// types that encode themselves are framed too
+	c, err := NewCodec[decimal](SafeOptions{Checksum: true})
+	require.NoError(t, err)
+	data, err := c.Marshal(&decimal{units: 125, scale: 2})
+	require.NoError(t, err)
+	assert.Equal(t, checksumMarker+"125/2", string(data[:len(data)-checksumLen]))
+	var d decimal
+	require.NoError(t, c.Unmarshal(data, &d))
+	assert.Equal(t, decimal{units: 125, scale: 2}, d)
+}
+
+func TestChecksum_Mismatch(t *testing.T) {
+	f := NewFractus(SafeOptions{Checksum: true})
+	data, err := f.Encode(&record{ID: 7, Name: "alpha", Count: 3})
+	require.NoError(t, err)
+	// every byte but the marker's, whose corruption makes a plain payload
+	for i := len(checksumMarker); i < len(data); i++ {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0x10
+		out := record{Name: "untouched"}
+		err := f.Decode(corrupt, &out)
+		var de *DecodeError
+		require.ErrorAs(t, err, &de, "byte %d", i)
+		assert.ErrorIs(t, err, ErrChecksumMismatch, "byte %d", i)
+		assert.Equal(t, len(data)-checksumLen, de.Offset)
+		assert.Equal(t, record{Name: "untouched"}, out, "byte %d", i)
+	}
+
+	var out record
+	assert.ErrorIs(t, f.Decode(data[:len(checksumMarker)+3], &out), ErrTruncated)
+}
+
+func TestStream_Checksum(t *testing.T) {
+	var conn bytes.Buffer
+	enc := NewEncoder(&conn, SafeOptions{Checksum: true})
+	require.NoError(t, enc.Encode(MixedStruct{Str: "framed"}))
+	raw := conn.Bytes()
+	raw[len(raw)-1] ^= 0xff
+
+	dec := NewDecoder(&conn, SafeOptions{Checksum: true})
+	var out MixedStruct
+	assert.ErrorIs(t, dec.Decode(&out), ErrChecksumMismatch)
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	in := record{
+		ID: 7, Name: "alpha", Tags: []string{"a"}, Blob: []byte{1},
+		Flags: map[string]uint16{"x": 1}, Active: true, Count: 4,
+	}
+	plain := NewFractus(SafeOptions{})
+	cases := []struct {
+		opts  SafeOptions
+		flags Flags
+	}{
+		{SafeOptions{Envelope: true}, 0},
+		{SafeOptions{Envelope: true, Checksum: true}, FlagChecksum},
+		{SafeOptions{Envelope: true, SelfDescribing: true, OffsetTable: true}, FlagSelfDescribing},
+		{SafeOptions{Envelope: true, OffsetTable: true, Checksum: true}, FlagOffsetTable | FlagChecksum},
+	}
+	for _, c := range cases {
+		f := NewFractus(c.opts)
+		data, err := f.Encode(&in)
+		require.NoError(t, err)
+		env, ok := plain.Sniff(data)
+		require.True(t, ok, "%+v", c.opts)
+		assert.Equal(t, Envelope{Version: FormatVersion, Flags: c.flags}, env, "%+v", c.opts)
+		size, err := f.Size(&in)
+		require.NoError(t, err)
+		assert.Equal(t, len(data), size, "%+v", c.opts)
+
+		// readers follow the envelope, not their own options
+		for _, r := range []*Fractus{plain, NewFractus(SafeOptions{SelfDescribing: true})} {
+			var out record
+			require.NoError(t, r.Decode(data, &out), "%+v", c.opts)
+			assert.Equal(t, in, out, "%+v", c.opts)
+
+			view, err := r.NewView(data, reflect.TypeFor[record]())
+			require.NoError(t, err, "%+v", c.opts)
+			count, err := view.Uint64(9)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(in.Count), count, "%+v", c.opts)
+
+			var part record
+			require.NoError(t, r.DecodeFields(data, &part, "Name"), "%+v", c.opts)
+			assert.Equal(t, in.Name, part.Name, "%+v", c.opts)
+		}
+		codec, err := NewCodec[record](SafeOptions{})
+		require.NoError(t, err)
+		var out record
+		require.NoError(t, codec.Unmarshal(data, &out), "%+v", c.opts)
+		assert.Equal(t, in, out, "%+v", c.opts)
+	}
+
+	// payloads without an envelope are told apart and still read
+	data, err := plain.Encode(&in)
+	require.NoError(t, err)
+	_, ok := plain.Sniff(data)
+	assert.False(t, ok)
+	var out record
+	require.NoError(t, NewFractus(SafeOptions{Envelope: true}).Decode(data, &out))
+	assert.Equal(t, in, out)
+}
+
+func TestEnvelope_Errors(t *testing.T) {
+	f := NewFractus(SafeOptions{Envelope: true})
+	data, err := f.Encode(&record{Name: "alpha"})
+	require.NoError(t, err)
+	with := func(version byte, flags Flags) []byte {
+		b := append([]byte(nil), data...)
+		b[len(envelopeMagic)], b[len(envelopeMagic)+1] = version, byte(flags)
+		return b
+	}
+
+	var out record
+	var de *DecodeError
+	err = f.Decode(with(2, 0), &out)
+	require.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrVersion)
+	assert.Equal(t, len(envelopeMagic), de.Offset)
+	assert.ErrorIs(t, f.Decode(with(FormatVersion, FlagCompressed), &out), ErrUnsupported)
+	assert.ErrorIs(t, f.Decode(with(FormatVersion, 0x80), &out), ErrUnsupported)
+	assert.ErrorIs(t, f.Decode(with(FormatVersion, FlagChecksum), &out), ErrChecksumMismatch)
+
+	// errors inside the body are reported at their offset in the payload
+	err = f.Decode(data[:len(data)-1], &out)
+	require.ErrorAs(t, err, &de)
+	assert.ErrorIs(t, err, ErrTruncated)
+	assert.Greater(t, de.Offset, envelopeLen)
+}
+
+type extent struct {
+	X, Y int32
+}
+
+type offset struct {
+	DX, DY int32
+}
+
+// swapped has extent's fields in the other order.
+type swapped struct {
+	Y int32 `fractus:"id=1"`
+	X int32 `fractus:"id=2"`
+}
+
+func TestFingerprint(t *testing.T) {
+	f := NewFractus(SafeOptions{})
+	fp := func(v any) uint64 {
+		sum, err := f.Fingerprint(reflect.TypeOf(v))
+		require.NoError(t, err)
+		return sum
+	}
+	type sameShape extent
+	assert.Equal(t, fp(extent{}), fp(&sameShape{}), "only the layout counts")
+	assert.NotEqual(t, fp(extent{}), fp(offset{}), "renamed fields")
+	assert.NotEqual(t, fp(extent{}), fp(swapped{}), "reordered fields")
+	assert.NotEqual(t, fp(record{}), fp(MixedStruct{}))
+	type renumbered struct {
+		X int32
+		Y int32 `fractus:"id=3"`
+	}
+	assert.NotEqual(t, fp(extent{}), fp(renumbered{}), "field ids")
+	// pinned, so a change to the hash is a deliberate format change
+	assert.Equal(t, uint64(0x8404e7642751eee1), fp(extent{}))
+
+	_, err := f.Fingerprint(reflect.TypeFor[decimal]())
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = f.Fingerprint(reflect.TypeFor[int]())
+	assert.ErrorIs(t, err, ErrNotStruct)
+}
+
+func TestFingerprint_Mode(t *testing.T) {
+	plain := NewFractus(SafeOptions{})
+	data, err := plain.Encode(extent{X: 1, Y: 2})
+	require.NoError(t, err)
+	var wrong offset
+	require.NoError(t, plain.Decode(data, &wrong), "same kinds decode silently without fingerprints")
+
+	for _, opts := range []SafeOptions{{Fingerprint: true}, {Fingerprint: true, Envelope: true, OffsetTable: true}} {
+		f := NewFractus(opts)
+		data, err := f.Encode(extent{X: 1, Y: 2})
+		require.NoError(t, err)
+		size, err := f.Size(extent{})
+		require.NoError(t, err)
+		assert.Equal(t, len(data), size, "%+v", opts)
+
+		var out extent
+		require.NoError(t, f.Decode(data, &out), "%+v", opts)
+		assert.Equal(t, extent{X: 1, Y: 2}, out)
+		view, err := f.NewView(data, reflect.TypeFor[extent]())
+		require.NoError(t, err, "%+v", opts)
+		y, err := view.Int64(1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), y, "%+v", opts)
+		c, err := NewCodec[extent](opts)
+		require.NoError(t, err)
+		out = extent{}
+		require.NoError(t, c.Unmarshal(data, &out), "%+v", opts)
+		assert.Equal(t, extent{X: 1, Y: 2}, out)
+
+		var de *DecodeError
+		err = f.Decode(data, &wrong)
+		require.ErrorAs(t, err, &de, "%+v", opts)
+		assert.ErrorIs(t, err, ErrSchemaMismatch)
+		assert.ErrorIs(t, f.DecodeFields(data, &wrong, "DX"), ErrSchemaMismatch)
+		_, err = f.NewView(data, reflect.TypeFor[swapped]())
+		assert.ErrorIs(t, err, ErrSchemaMismatch)
+	}
+
+	// tags alone change the layout: omitempty adds a presence bitmap
+	type bare struct {
+		X int
+		Y string
+	}
+	type tagged struct {
+		X int `fractus:",omitempty"`
+		Y string
+	}
+	f := NewFractus(SafeOptions{Fingerprint: true})
+	data, err = f.Encode(bare{X: 1, Y: "y"})
+	require.NoError(t, err)
+	var other tagged
+	assert.ErrorIs(t, f.Decode(data, &other), ErrSchemaMismatch)
+
+	// an envelope tells readers to check, whatever their options
+	data, err = NewFractus(SafeOptions{Fingerprint: true, Envelope: true}).Encode(extent{})
+	require.NoError(t, err)
+	assert.ErrorIs(t, plain.Decode(data, &wrong), ErrSchemaMismatch)
+}
+
+type invoice struct {
+	Number  uint32 `fractus:"id=1"`
+	Lines   []invoiceLine
+	Totals  map[string]decimal `fractus:",omitempty"`
+	Digest  [4]byte
+	Parent  *invoice
+	Billing struct {
+		City string
+	}
+	Due    time.Time
+	Labels map[extent][]string `fractus:"labels,id=9"`
+}
+
+type invoiceLine struct {
+	Item  string
+	Where extent
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(&invoice{})
+	require.NotNil(t, s)
+	want := `message invoice {
+  1 Number uint32
+  2 Lines []invoiceLine
+  3 Totals map[string]custom(decimal) omitempty
+  4 Digest [4]uint8
+  5 Parent *invoice
+  6 Billing invoice_Billing
+  7 Due custom(Time)
+  9 labels map[extent][]string
+}
+
+message invoiceLine {
+  1 Item string
+  2 Where extent
+}
+
+message extent {
+  1 X int32
+  2 Y int32
+}
+
+message invoice_Billing {
+  1 City string
+}
+`
+	assert.Equal(t, want, string(s.IDL()))
+
+	parsed, err := ParseSchema(s.IDL())
+	require.NoError(t, err)
+	assert.Equal(t, s, parsed)
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var fromJSON Schema
+	require.NoError(t, json.Unmarshal(data, &fromJSON))
+	assert.Equal(t, s, &fromJSON)
+	assert.Contains(t, string(data), `{"id":3,"name":"Totals","type":{"kind":"map","key":{"kind":"string"},"elem":{"kind":"custom","name":"decimal"}},"omitempty":true}`)
+
+	assert.Nil(t, SchemaOf(decimal{}), "types that encode themselves have no schema")
+	assert.Nil(t, SchemaOf(42))
+}
+
+func TestParseSchema_Errors(t *testing.T) {
+	for name, idl := range map[string]string{
+		"no message":   "1 X int32\n",
+		"unclosed":     "message A {\n  1 X int32\n",
+		"twice":        "message A {\n}\nmessage A {\n}\n",
+		"bad number":   "message A {\n  x X int32\n}\n",
+		"no type":      "message A {\n  1 X\n}\n",
+		"bad type":     "message A {\n  1 X map[string\n}\n",
+		"bad option":   "message A {\n  1 X int32 required\n}\n",
+		"undefined":    "message A {\n  1 B []B\n}\n",
+		"bad array":    "message A {\n  1 X [n]int32\n}\n",
+		"empty custom": "message A {\n  1 X custom()\n}\n",
+	} {
+		_, err := ParseSchema([]byte(idl))
+		assert.ErrorIs(t, err, ErrInvalidSchema, name)
+	}
+
+	// comments, blank lines and quoted names
+	s, err := ParseSchema([]byte("// orders\n\nmessage A {\n  1 \"two words\" *A omitempty\n}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, SchemaField{
+		ID: 1, Name: "two words", OmitEmpty: true,
+		Type: SchemaType{Kind: "ptr", Elem: &SchemaType{Kind: "struct", Name: "A"}},
+	}, s.Messages[0].Fields[0])
+	assert.Contains(t, string(s.IDL()), `1 "two words" *A omitempty`)
+}
+
+// A fingerprint whose low bytes spell the checksum marker must not be
+// taken for one.
+func TestFingerprint_MarkerCollision(t *testing.T) {
+	typ := reflect.StructOf([]reflect.StructField{{Name: "F4412", Type: reflect.TypeFor[int32]()}})
+	for _, opts := range []SafeOptions{{Fingerprint: true}, {Fingerprint: true, Checksum: true}} {
+		f := NewFractus(opts)
+		sum, err := f.Fingerprint(typ)
+		require.NoError(t, err)
+		require.Equal(t, checksumMarker, string(binary.LittleEndian.AppendUint64(nil, sum)[:2]))
+
+		in := reflect.New(typ)
+		in.Elem().Field(0).SetInt(-7)
+		data, err := f.Encode(in.Interface())
+		require.NoError(t, err)
+		out := reflect.New(typ)
+		require.NoError(t, f.Decode(data, out.Interface()), "%+v", opts)
+		assert.Equal(t, int64(-7), out.Elem().Field(0).Int())
+	}
+}
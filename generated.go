@@ -0,0 +1,162 @@
+package fractus
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// This file holds the hooks and helpers used by code generated with
+// cmd/fractusgen. Generated MarshalFractus/UnmarshalFractus methods produce
+// and accept exactly the bytes of the reflective compact encoding, so the
+// helpers are thin exported wrappers around the reflective codec's own
+// primitives rather than a second implementation.
+
+// generated is implemented by types whose Marshaler and Unmarshaler
+// methods were written by cmd/fractusgen. Their payload is the compact
+// struct encoding, so they only stand in for reflection in compact mode;
+// self-describing and compatible modes still walk their fields.
+type generated interface {
+	FractusGenerated()
+}
+
+var generatedType = reflect.TypeFor[generated]()
+
+// useGenerated reports whether generated methods may stand in for the
+// reflective codec. They only speak the strict compact layout, without an
+// offset table or fingerprint, keep the zone offset of times, and know
+// nothing of codecs registered on f or of decode limits.
+func (f *Fractus) useGenerated() bool {
+	return !f.Opts.SelfDescribing && !f.Opts.Compatible && !f.Opts.OffsetTable &&
+		!f.Opts.Fingerprint && !f.Opts.UTCTimes && f.Opts.Limits == (DecodeLimits{}) &&
+		len(f.codecs) == 0
+}
+
+// generatedPanic carries an error out of a generated MarshalFractus, which
+// has no way to return one; see AppendTime and marshalValue.
+type generatedPanic struct {
+	err error
+}
+
+// Runtime support for generated code.
+//
+// The declarations from here to the end of the file are exported only so
+// that code written by cmd/fractusgen can reach the codec's primitives.
+// They are not meant to be called directly: they follow the generator and
+// change with it.
+
+// AppendVarUint appends x to dst as a VarInt.
+//
+// For generated code only.
+func AppendVarUint(dst []byte, x uint64) []byte {
+	return writeVarUint(dst, x)
+}
+
+// InsertVarUint inserts x as a VarInt at buf[at], shifting the tail right.
+// Generated code uses it to length-prefix nested structs after encoding them.
+//
+// For generated code only.
+func InsertVarUint(buf []byte, at int, x uint64) []byte {
+	return insertVarUint(buf, at, x)
+}
+
+// ReadVarUint reads the VarInt at b[pos] and returns it with the offset just
+// past it. VarInts longer than needed are rejected with
+// ErrVarintNonCanonical, so frame markers are never read as counts.
+//
+// For generated code only.
+func ReadVarUint(b []byte, pos int) (uint64, int, error) {
+	if err := checkCanonical(b, pos); err != nil {
+		return 0, pos, err
+	}
+	return readVarUintAt(b, pos)
+}
+
+// ReadCount reads a length or element count at b[pos] and rejects it when
+// the remaining input cannot hold that many elements of at least width
+// bytes each, or when it is not in its shortest form.
+//
+// For generated code only.
+func ReadCount(b []byte, pos, width int) (int, int, error) {
+	if err := checkCanonical(b, pos); err != nil {
+		return 0, pos, err
+	}
+	return readCountAt(b, pos, width)
+}
+
+// CheckDepth fails with ErrLimitExceeded when depth goes over
+// DefaultMaxDepth. Generated decoders check it before each nested struct,
+// the only place they recurse; they never run with DecodeLimits set.
+//
+// For generated code only.
+func CheckDepth(depth int) error {
+	return (&DecodeLimits{}).checkDepth(depth)
+}
+
+// FieldError wraps err in a *DecodeError for the given offset and field
+// index, unless err already is one.
+//
+// For generated code only.
+func FieldError(offset, field int, err error) error {
+	return fieldErr(offset, field, err)
+}
+
+// MapEntry locates one encoded key/value pair inside an entry buffer.
+//
+// For generated code only.
+type MapEntry struct {
+	Start, KeyEnd, End int
+}
+
+// AppendMapEntries appends the entries encoded in buf to dst, sorted by
+// their key bytes with ties broken by the value bytes. This is the canonical
+// map entry order of the format.
+//
+// For generated code only.
+func AppendMapEntries(dst, buf []byte, entries []MapEntry) []byte {
+	slices.SortFunc(entries, func(a, b MapEntry) int {
+		if c := bytes.Compare(buf[a.Start:a.KeyEnd], buf[b.Start:b.KeyEnd]); c != 0 {
+			return c
+		}
+		return bytes.Compare(buf[a.KeyEnd:a.End], buf[b.KeyEnd:b.End])
+	})
+	for _, e := range entries {
+		dst = append(dst, buf[e.Start:e.End]...)
+	}
+	return dst
+}
+
+// UnmarshalAt hands b[start:end] to u. Decode errors u reports relative to
+// its payload are moved to their absolute offset in b. Generated code uses
+// it for fields of custom types.
+//
+// For generated code only.
+func UnmarshalAt(u Unmarshaler, b []byte, start, end int) error {
+	return rebase(u.UnmarshalFractus(b[start:end:end]), start)
+}
+
+// AppendTime appends t as a time.Time field: a VarInt byte length followed
+// by the payload of the built-in time encoding. MarshalFractus cannot
+// fail, so for a time outside the int64 nanosecond range AppendTime
+// panics; Encode and the other Fractus calls that reach the generated
+// method recover and return the error instead.
+//
+// For generated code only.
+func AppendTime(dst []byte, t time.Time) []byte {
+	// the payload is at most 12 bytes, so its length takes one byte
+	start := len(dst)
+	out, err := appendTime(append(dst, 0), t, false)
+	if err != nil {
+		panic(generatedPanic{err})
+	}
+	out[start] = byte(len(out) - start - 1)
+	return out
+}
+
+// ReadTime decodes the payload of a time.Time field, without its length.
+//
+// For generated code only.
+func ReadTime(b []byte) (time.Time, error) {
+	return parseTime(b, false)
+}
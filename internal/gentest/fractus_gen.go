@@ -0,0 +1,928 @@
+// Code generated by fractusgen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/rawbytedev/fractus"
+)
+
+// FractusGenerated marks the methods of Order as generated by fractusgen.
+func (Order) FractusGenerated() {}
+
+// MarshalFractus appends the Fractus encoding of x to dst.
+func (x Order) MarshalFractus(dst []byte) []byte {
+	dst = fractus.AppendVarUint(dst, 22)
+	bm := len(dst)
+	dst = append(dst, make([]byte, 3)...)
+	// ID
+	{
+		dst[bm] |= 1
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(x.ID))
+	}
+	// Customer
+	{
+		dst[bm] |= 2
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Customer)))
+		dst = append(dst, x.Customer...)
+	}
+	// Items
+	{
+		dst[bm] |= 4
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Items)))
+		for _, v1 := range x.Items {
+			start2 := len(dst)
+			dst = v1.MarshalFractus(dst)
+			dst = fractus.InsertVarUint(dst, start2, uint64(len(dst)-start2))
+		}
+	}
+	// Tags
+	{
+		dst[bm] |= 8
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Tags)))
+		if len(x.Tags) > 0 {
+			var buf3 []byte
+			entries4 := make([]fractus.MapEntry, 0, len(x.Tags))
+			for k5, v6 := range x.Tags {
+				e7 := fractus.MapEntry{Start: len(buf3)}
+				buf3 = fractus.AppendVarUint(buf3, uint64(len(k5)))
+				buf3 = append(buf3, k5...)
+				e7.KeyEnd = len(buf3)
+				buf3 = binary.LittleEndian.AppendUint32(buf3, uint32(v6))
+				e7.End = len(buf3)
+				entries4 = append(entries4, e7)
+			}
+			dst = fractus.AppendMapEntries(dst, buf3, entries4)
+		}
+	}
+	// Hash
+	{
+		dst[bm] |= 16
+		dst = append(dst, x.Hash[:]...)
+	}
+	// Weights
+	{
+		dst[bm] |= 32
+		for i8 := range x.Weights {
+			dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(float32(x.Weights[i8])))
+		}
+	}
+	// Note
+	if x.Note != nil {
+		dst[bm] |= 64
+		if x.Note == nil {
+			dst = append(dst, 0)
+		} else {
+			dst = append(dst, 1)
+			dst = fractus.AppendVarUint(dst, uint64(len(*x.Note)))
+			dst = append(dst, *x.Note...)
+		}
+	}
+	// Parent
+	if x.Parent != nil {
+		dst[bm] |= 128
+		if x.Parent == nil {
+			dst = append(dst, 0)
+		} else {
+			dst = append(dst, 1)
+			start9 := len(dst)
+			dst = x.Parent.MarshalFractus(dst)
+			dst = fractus.InsertVarUint(dst, start9, uint64(len(dst)-start9))
+		}
+	}
+	// Status
+	{
+		dst[bm+1] |= 1
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(x.Status))
+	}
+	// Count
+	{
+		dst[bm+1] |= 2
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(x.Count))
+	}
+	// Blob
+	{
+		dst[bm+1] |= 4
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Blob)))
+		dst = append(dst, x.Blob...)
+	}
+	// Matrix
+	{
+		dst[bm+1] |= 8
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Matrix)))
+		for _, v10 := range x.Matrix {
+			dst = fractus.AppendVarUint(dst, uint64(len(v10)))
+			for _, v11 := range v10 {
+				dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(float64(v11)))
+			}
+		}
+	}
+	// Flag
+	{
+		dst[bm+1] |= 16
+		if x.Flag {
+			dst = append(dst, 1)
+		} else {
+			dst = append(dst, 0)
+		}
+	}
+	// Small
+	{
+		dst[bm+1] |= 32
+		dst = append(dst, byte(x.Small))
+	}
+	// Port
+	{
+		dst[bm+1] |= 64
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(x.Port))
+	}
+	// Delta
+	{
+		dst[bm+1] |= 128
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(x.Delta))
+	}
+	// Wait
+	{
+		dst[bm+2] |= 1
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(x.Wait))
+	}
+	// Index
+	{
+		dst[bm+2] |= 2
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Index)))
+		if len(x.Index) > 0 {
+			var buf12 []byte
+			entries13 := make([]fractus.MapEntry, 0, len(x.Index))
+			for k14, v15 := range x.Index {
+				e16 := fractus.MapEntry{Start: len(buf12)}
+				buf12 = append(buf12, k14[:]...)
+				e16.KeyEnd = len(buf12)
+				buf12 = fractus.AppendVarUint(buf12, uint64(len(v15)))
+				for _, v17 := range v15 {
+					buf12 = fractus.AppendVarUint(buf12, uint64(len(v17)))
+					buf12 = append(buf12, v17...)
+				}
+				e16.End = len(buf12)
+				entries13 = append(entries13, e16)
+			}
+			dst = fractus.AppendMapEntries(dst, buf12, entries13)
+		}
+	}
+	// Ratio
+	if x.Ratio != 0 {
+		dst[bm+2] |= 4
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(float64(x.Ratio)))
+	}
+	// Origin
+	{
+		dst[bm+2] |= 8
+		start18 := len(dst)
+		dst = x.Origin.MarshalFractus(dst)
+		dst = fractus.InsertVarUint(dst, start18, uint64(len(dst)-start18))
+	}
+	// Ref
+	{
+		dst[bm+2] |= 16
+		start19 := len(dst)
+		dst = x.Ref.MarshalFractus(dst)
+		dst = fractus.InsertVarUint(dst, start19, uint64(len(dst)-start19))
+	}
+	// Related
+	{
+		dst[bm+2] |= 32
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Related)))
+		for _, v20 := range x.Related {
+			start21 := len(dst)
+			dst = v20.MarshalFractus(dst)
+			dst = fractus.InsertVarUint(dst, start21, uint64(len(dst)-start21))
+		}
+	}
+	return dst
+}
+
+// UnmarshalFractus decodes a Fractus payload into x.
+func (x *Order) UnmarshalFractus(b []byte) error {
+	if p, err := x.decodeFractus(b, 0, 0); err != nil {
+		return fractus.FieldError(p, -1, err)
+	}
+	return nil
+}
+
+func (x *Order) decodeFractus(b []byte, p, depth int) (int, error) {
+	n, p, err := fractus.ReadVarUint(b, p)
+	if err != nil {
+		return p, err
+	}
+	if n != 22 {
+		return p, fractus.ErrFieldCount
+	}
+	if len(b)-p < 3 {
+		return p, fractus.ErrLengthTooLarge
+	}
+	bm := b[p : p+3]
+	p += 3
+	// ID
+	if bm[0]&1 == 0 {
+		x.ID = 0
+	} else {
+		if len(b)-p < 8 {
+			return p, fractus.FieldError(p, 0, fractus.ErrTruncated)
+		}
+		x.ID = uint64(binary.LittleEndian.Uint64(b[p:]))
+		p += 8
+	}
+	// Customer
+	if bm[0]&2 == 0 {
+		x.Customer = ""
+	} else {
+		n22, q23, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 1, err)
+		}
+		x.Customer = string(b[q23 : q23+n22])
+		p = q23 + n22
+	}
+	// Items
+	if bm[0]&4 == 0 {
+		x.Items = nil
+	} else {
+		n24, q25, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 2, err)
+		}
+		p = q25
+		s26 := make([]Item, n24)
+		for i27 := range s26 {
+			if err := fractus.CheckDepth(depth + 2); err != nil {
+				return p, fractus.FieldError(p, 2, err)
+			}
+			n28, q29, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 2, err)
+			}
+			if at30, err := s26[i27].decodeFractus(b[:q29+n28], q29, depth+2); err != nil {
+				return at30, fractus.FieldError(at30, 2, err)
+			}
+			p = q29 + n28
+		}
+		x.Items = s26
+	}
+	// Tags
+	if bm[0]&8 == 0 {
+		x.Tags = nil
+	} else {
+		n31, q32, err := fractus.ReadCount(b, p, 5)
+		if err != nil {
+			return p, fractus.FieldError(p, 3, err)
+		}
+		p = q32
+		m33 := make(map[string]int32, n31)
+		for i34 := 0; i34 < n31; i34++ {
+			var k35 string
+			n37, q38, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 3, err)
+			}
+			k35 = string(b[q38 : q38+n37])
+			p = q38 + n37
+			var v36 int32
+			if len(b)-p < 4 {
+				return p, fractus.FieldError(p, 3, fractus.ErrTruncated)
+			}
+			v36 = int32(int32(binary.LittleEndian.Uint32(b[p:])))
+			p += 4
+			m33[k35] = v36
+		}
+		x.Tags = m33
+	}
+	// Hash
+	if bm[0]&16 == 0 {
+		x.Hash = [8]byte{}
+	} else {
+		if len(b)-p < 8 {
+			return p, fractus.FieldError(p, 4, fractus.ErrTruncated)
+		}
+		copy(x.Hash[:], b[p:])
+		p += 8
+	}
+	// Weights
+	if bm[0]&32 == 0 {
+		x.Weights = [3]float32{}
+	} else {
+		if len(b)-p < 12 {
+			return p, fractus.FieldError(p, 5, fractus.ErrTruncated)
+		}
+		for i39 := range x.Weights {
+			if len(b)-p < 4 {
+				return p, fractus.FieldError(p, 5, fractus.ErrTruncated)
+			}
+			x.Weights[i39] = float32(math.Float32frombits(binary.LittleEndian.Uint32(b[p:])))
+			p += 4
+		}
+	}
+	// Note
+	if bm[0]&64 == 0 {
+		x.Note = nil
+	} else {
+		if p >= len(b) {
+			return p, fractus.FieldError(p, 6, fractus.ErrTruncated)
+		}
+		switch b[p] {
+		case 0:
+			x.Note = nil
+			p++
+		case 1:
+			p++
+			if x.Note == nil {
+				x.Note = new(string)
+			}
+			n40, q41, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 6, err)
+			}
+			*x.Note = string(b[q41 : q41+n40])
+			p = q41 + n40
+		default:
+			return p, fractus.FieldError(p, 6, fractus.ErrInvalidPresence)
+		}
+	}
+	// Parent
+	if bm[0]&128 == 0 {
+		x.Parent = nil
+	} else {
+		if p >= len(b) {
+			return p, fractus.FieldError(p, 7, fractus.ErrTruncated)
+		}
+		switch b[p] {
+		case 0:
+			x.Parent = nil
+			p++
+		case 1:
+			p++
+			if x.Parent == nil {
+				x.Parent = new(Order)
+			}
+			if err := fractus.CheckDepth(depth + 2); err != nil {
+				return p, fractus.FieldError(p, 7, err)
+			}
+			n42, q43, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 7, err)
+			}
+			if at44, err := x.Parent.decodeFractus(b[:q43+n42], q43, depth+2); err != nil {
+				return at44, fractus.FieldError(at44, 7, err)
+			}
+			p = q43 + n42
+		default:
+			return p, fractus.FieldError(p, 7, fractus.ErrInvalidPresence)
+		}
+	}
+	// Status
+	if bm[1]&1 == 0 {
+		x.Status = 0
+	} else {
+		if len(b)-p < 2 {
+			return p, fractus.FieldError(p, 8, fractus.ErrTruncated)
+		}
+		x.Status = Status(int16(binary.LittleEndian.Uint16(b[p:])))
+		p += 2
+	}
+	// Count
+	if bm[1]&2 == 0 {
+		x.Count = 0
+	} else {
+		if len(b)-p < 8 {
+			return p, fractus.FieldError(p, 9, fractus.ErrTruncated)
+		}
+		if v45 := int64(binary.LittleEndian.Uint64(b[p:])); int64(int(v45)) != v45 {
+			return p, fractus.FieldError(p, 9, fractus.ErrIntOverflow)
+		} else {
+			x.Count = int(v45)
+		}
+		p += 8
+	}
+	// Blob
+	if bm[1]&4 == 0 {
+		x.Blob = nil
+	} else {
+		n46, q47, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 11, err)
+		}
+		p = q47
+		s48 := make([]byte, n46)
+		copy(s48, b[p:])
+		p += n46
+		x.Blob = s48
+	}
+	// Matrix
+	if bm[1]&8 == 0 {
+		x.Matrix = nil
+	} else {
+		n49, q50, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 12, err)
+		}
+		p = q50
+		s51 := make([][]float64, n49)
+		for i52 := range s51 {
+			n53, q54, err := fractus.ReadCount(b, p, 8)
+			if err != nil {
+				return p, fractus.FieldError(p, 12, err)
+			}
+			p = q54
+			s55 := make([]float64, n53)
+			for i56 := range s55 {
+				if len(b)-p < 8 {
+					return p, fractus.FieldError(p, 12, fractus.ErrTruncated)
+				}
+				s55[i56] = float64(math.Float64frombits(binary.LittleEndian.Uint64(b[p:])))
+				p += 8
+			}
+			s51[i52] = s55
+		}
+		x.Matrix = s51
+	}
+	// Flag
+	if bm[1]&16 == 0 {
+		x.Flag = false
+	} else {
+		if len(b)-p < 1 {
+			return p, fractus.FieldError(p, 13, fractus.ErrTruncated)
+		}
+		x.Flag = bool(b[p] != 0)
+		p += 1
+	}
+	// Small
+	if bm[1]&32 == 0 {
+		x.Small = 0
+	} else {
+		if len(b)-p < 1 {
+			return p, fractus.FieldError(p, 14, fractus.ErrTruncated)
+		}
+		x.Small = int8(int8(b[p]))
+		p += 1
+	}
+	// Port
+	if bm[1]&64 == 0 {
+		x.Port = 0
+	} else {
+		if len(b)-p < 2 {
+			return p, fractus.FieldError(p, 15, fractus.ErrTruncated)
+		}
+		x.Port = uint16(binary.LittleEndian.Uint16(b[p:]))
+		p += 2
+	}
+	// Delta
+	if bm[1]&128 == 0 {
+		x.Delta = 0
+	} else {
+		if len(b)-p < 2 {
+			return p, fractus.FieldError(p, 16, fractus.ErrTruncated)
+		}
+		x.Delta = int16(int16(binary.LittleEndian.Uint16(b[p:])))
+		p += 2
+	}
+	// Wait
+	if bm[2]&1 == 0 {
+		x.Wait = 0
+	} else {
+		if len(b)-p < 8 {
+			return p, fractus.FieldError(p, 17, fractus.ErrTruncated)
+		}
+		x.Wait = time.Duration(int64(binary.LittleEndian.Uint64(b[p:])))
+		p += 8
+	}
+	// Index
+	if bm[2]&2 == 0 {
+		x.Index = nil
+	} else {
+		n57, q58, err := fractus.ReadCount(b, p, 3)
+		if err != nil {
+			return p, fractus.FieldError(p, 18, err)
+		}
+		p = q58
+		m59 := make(map[[2]uint8][]string, n57)
+		for i60 := 0; i60 < n57; i60++ {
+			var k61 [2]uint8
+			if len(b)-p < 2 {
+				return p, fractus.FieldError(p, 18, fractus.ErrTruncated)
+			}
+			copy(k61[:], b[p:])
+			p += 2
+			var v62 []string
+			n63, q64, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 18, err)
+			}
+			p = q64
+			s65 := make([]string, n63)
+			for i66 := range s65 {
+				n67, q68, err := fractus.ReadCount(b, p, 1)
+				if err != nil {
+					return p, fractus.FieldError(p, 18, err)
+				}
+				s65[i66] = string(b[q68 : q68+n67])
+				p = q68 + n67
+			}
+			v62 = s65
+			m59[k61] = v62
+		}
+		x.Index = m59
+	}
+	// Ratio
+	if bm[2]&4 == 0 {
+		x.Ratio = 0
+	} else {
+		if len(b)-p < 8 {
+			return p, fractus.FieldError(p, 19, fractus.ErrTruncated)
+		}
+		x.Ratio = float64(math.Float64frombits(binary.LittleEndian.Uint64(b[p:])))
+		p += 8
+	}
+	// Origin
+	if bm[2]&8 == 0 {
+		x.Origin = Point{}
+	} else {
+		if err := fractus.CheckDepth(depth + 1); err != nil {
+			return p, fractus.FieldError(p, 20, err)
+		}
+		n69, q70, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 20, err)
+		}
+		if at71, err := x.Origin.decodeFractus(b[:q70+n69], q70, depth+1); err != nil {
+			return at71, fractus.FieldError(at71, 20, err)
+		}
+		p = q70 + n69
+	}
+	// Ref
+	if bm[2]&16 == 0 {
+		x.Ref = UUID{}
+	} else {
+		n72, q73, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 21, err)
+		}
+		if err := fractus.UnmarshalAt(&x.Ref, b, q73, q73+n72); err != nil {
+			return q73, fractus.FieldError(q73, 21, err)
+		}
+		p = q73 + n72
+	}
+	// Related
+	if bm[2]&32 == 0 {
+		x.Related = nil
+	} else {
+		n74, q75, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 22, err)
+		}
+		p = q75
+		s76 := make([]UUID, n74)
+		for i77 := range s76 {
+			n78, q79, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 22, err)
+			}
+			if err := fractus.UnmarshalAt(&s76[i77], b, q79, q79+n78); err != nil {
+				return q79, fractus.FieldError(q79, 22, err)
+			}
+			p = q79 + n78
+		}
+		x.Related = s76
+	}
+	return p, nil
+}
+
+// FractusGenerated marks the methods of Event as generated by fractusgen.
+func (Event) FractusGenerated() {}
+
+// MarshalFractus appends the Fractus encoding of x to dst.
+func (x Event) MarshalFractus(dst []byte) []byte {
+	dst = fractus.AppendVarUint(dst, 6)
+	bm := len(dst)
+	dst = append(dst, make([]byte, 1)...)
+	// Name
+	{
+		dst[bm] |= 1
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Name)))
+		dst = append(dst, x.Name...)
+	}
+	// At
+	{
+		dst[bm] |= 2
+		dst = fractus.AppendTime(dst, x.At)
+	}
+	// Seen
+	if x.Seen != nil {
+		dst[bm] |= 4
+		if x.Seen == nil {
+			dst = append(dst, 0)
+		} else {
+			dst = append(dst, 1)
+			dst = fractus.AppendTime(dst, *x.Seen)
+		}
+	}
+	// Log
+	{
+		dst[bm] |= 8
+		dst = fractus.AppendVarUint(dst, uint64(len(x.Log)))
+		for _, v80 := range x.Log {
+			dst = fractus.AppendTime(dst, v80)
+		}
+	}
+	// Until
+	if x.Until != (time.Time{}) {
+		dst[bm] |= 16
+		dst = fractus.AppendTime(dst, x.Until)
+	}
+	// ByKey
+	{
+		dst[bm] |= 32
+		dst = fractus.AppendVarUint(dst, uint64(len(x.ByKey)))
+		if len(x.ByKey) > 0 {
+			var buf81 []byte
+			entries82 := make([]fractus.MapEntry, 0, len(x.ByKey))
+			for k83, v84 := range x.ByKey {
+				e85 := fractus.MapEntry{Start: len(buf81)}
+				buf81 = fractus.AppendVarUint(buf81, uint64(len(k83)))
+				buf81 = append(buf81, k83...)
+				e85.KeyEnd = len(buf81)
+				buf81 = fractus.AppendTime(buf81, v84)
+				e85.End = len(buf81)
+				entries82 = append(entries82, e85)
+			}
+			dst = fractus.AppendMapEntries(dst, buf81, entries82)
+		}
+	}
+	return dst
+}
+
+// UnmarshalFractus decodes a Fractus payload into x.
+func (x *Event) UnmarshalFractus(b []byte) error {
+	if p, err := x.decodeFractus(b, 0, 0); err != nil {
+		return fractus.FieldError(p, -1, err)
+	}
+	return nil
+}
+
+func (x *Event) decodeFractus(b []byte, p, depth int) (int, error) {
+	n, p, err := fractus.ReadVarUint(b, p)
+	if err != nil {
+		return p, err
+	}
+	if n != 6 {
+		return p, fractus.ErrFieldCount
+	}
+	if len(b)-p < 1 {
+		return p, fractus.ErrLengthTooLarge
+	}
+	bm := b[p : p+1]
+	p += 1
+	// Name
+	if bm[0]&1 == 0 {
+		x.Name = ""
+	} else {
+		n86, q87, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 0, err)
+		}
+		x.Name = string(b[q87 : q87+n86])
+		p = q87 + n86
+	}
+	// At
+	if bm[0]&2 == 0 {
+		x.At = time.Time{}
+	} else {
+		n88, q89, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 1, err)
+		}
+		t90, err := fractus.ReadTime(b[q89 : q89+n88])
+		if err != nil {
+			return q89, fractus.FieldError(q89, 1, err)
+		}
+		x.At = t90
+		p = q89 + n88
+	}
+	// Seen
+	if bm[0]&4 == 0 {
+		x.Seen = nil
+	} else {
+		if p >= len(b) {
+			return p, fractus.FieldError(p, 2, fractus.ErrTruncated)
+		}
+		switch b[p] {
+		case 0:
+			x.Seen = nil
+			p++
+		case 1:
+			p++
+			if x.Seen == nil {
+				x.Seen = new(time.Time)
+			}
+			n91, q92, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 2, err)
+			}
+			t93, err := fractus.ReadTime(b[q92 : q92+n91])
+			if err != nil {
+				return q92, fractus.FieldError(q92, 2, err)
+			}
+			*x.Seen = t93
+			p = q92 + n91
+		default:
+			return p, fractus.FieldError(p, 2, fractus.ErrInvalidPresence)
+		}
+	}
+	// Log
+	if bm[0]&8 == 0 {
+		x.Log = nil
+	} else {
+		n94, q95, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 3, err)
+		}
+		p = q95
+		s96 := make([]time.Time, n94)
+		for i97 := range s96 {
+			n98, q99, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 3, err)
+			}
+			t100, err := fractus.ReadTime(b[q99 : q99+n98])
+			if err != nil {
+				return q99, fractus.FieldError(q99, 3, err)
+			}
+			s96[i97] = t100
+			p = q99 + n98
+		}
+		x.Log = s96
+	}
+	// Until
+	if bm[0]&16 == 0 {
+		x.Until = time.Time{}
+	} else {
+		n101, q102, err := fractus.ReadCount(b, p, 1)
+		if err != nil {
+			return p, fractus.FieldError(p, 4, err)
+		}
+		t103, err := fractus.ReadTime(b[q102 : q102+n101])
+		if err != nil {
+			return q102, fractus.FieldError(q102, 4, err)
+		}
+		x.Until = t103
+		p = q102 + n101
+	}
+	// ByKey
+	if bm[0]&32 == 0 {
+		x.ByKey = nil
+	} else {
+		n104, q105, err := fractus.ReadCount(b, p, 2)
+		if err != nil {
+			return p, fractus.FieldError(p, 5, err)
+		}
+		p = q105
+		m106 := make(map[string]time.Time, n104)
+		for i107 := 0; i107 < n104; i107++ {
+			var k108 string
+			n110, q111, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 5, err)
+			}
+			k108 = string(b[q111 : q111+n110])
+			p = q111 + n110
+			var v109 time.Time
+			n112, q113, err := fractus.ReadCount(b, p, 1)
+			if err != nil {
+				return p, fractus.FieldError(p, 5, err)
+			}
+			t114, err := fractus.ReadTime(b[q113 : q113+n112])
+			if err != nil {
+				return q113, fractus.FieldError(q113, 5, err)
+			}
+			v109 = t114
+			p = q113 + n112
+			m106[k108] = v109
+		}
+		x.ByKey = m106
+	}
+	return p, nil
+}
+
+// FractusGenerated marks the methods of Item as generated by fractusgen.
+func (Item) FractusGenerated() {}
+
+// MarshalFractus appends the Fractus encoding of x to dst.
+func (x Item) MarshalFractus(dst []byte) []byte {
+	dst = fractus.AppendVarUint(dst, 4)
+	// SKU
+	dst = fractus.AppendVarUint(dst, uint64(len(x.SKU)))
+	dst = append(dst, x.SKU...)
+	// Qty
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(x.Qty))
+	// Price
+	dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(float64(x.Price)))
+	// At
+	start115 := len(dst)
+	dst = x.At.MarshalFractus(dst)
+	dst = fractus.InsertVarUint(dst, start115, uint64(len(dst)-start115))
+	return dst
+}
+
+// UnmarshalFractus decodes a Fractus payload into x.
+func (x *Item) UnmarshalFractus(b []byte) error {
+	if p, err := x.decodeFractus(b, 0, 0); err != nil {
+		return fractus.FieldError(p, -1, err)
+	}
+	return nil
+}
+
+func (x *Item) decodeFractus(b []byte, p, depth int) (int, error) {
+	n, p, err := fractus.ReadVarUint(b, p)
+	if err != nil {
+		return p, err
+	}
+	if n != 4 {
+		return p, fractus.ErrFieldCount
+	}
+	// SKU
+	n116, q117, err := fractus.ReadCount(b, p, 1)
+	if err != nil {
+		return p, fractus.FieldError(p, 0, err)
+	}
+	x.SKU = string(b[q117 : q117+n116])
+	p = q117 + n116
+	// Qty
+	if len(b)-p < 4 {
+		return p, fractus.FieldError(p, 1, fractus.ErrTruncated)
+	}
+	x.Qty = uint32(binary.LittleEndian.Uint32(b[p:]))
+	p += 4
+	// Price
+	if len(b)-p < 8 {
+		return p, fractus.FieldError(p, 2, fractus.ErrTruncated)
+	}
+	x.Price = float64(math.Float64frombits(binary.LittleEndian.Uint64(b[p:])))
+	p += 8
+	// At
+	if err := fractus.CheckDepth(depth + 1); err != nil {
+		return p, fractus.FieldError(p, 3, err)
+	}
+	n118, q119, err := fractus.ReadCount(b, p, 1)
+	if err != nil {
+		return p, fractus.FieldError(p, 3, err)
+	}
+	if at120, err := x.At.decodeFractus(b[:q119+n118], q119, depth+1); err != nil {
+		return at120, fractus.FieldError(at120, 3, err)
+	}
+	p = q119 + n118
+	return p, nil
+}
+
+// FractusGenerated marks the methods of Point as generated by fractusgen.
+func (Point) FractusGenerated() {}
+
+// MarshalFractus appends the Fractus encoding of x to dst.
+func (x Point) MarshalFractus(dst []byte) []byte {
+	dst = fractus.AppendVarUint(dst, 2)
+	// X
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(x.X))
+	// Y
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(x.Y))
+	return dst
+}
+
+// UnmarshalFractus decodes a Fractus payload into x.
+func (x *Point) UnmarshalFractus(b []byte) error {
+	if p, err := x.decodeFractus(b, 0, 0); err != nil {
+		return fractus.FieldError(p, -1, err)
+	}
+	return nil
+}
+
+func (x *Point) decodeFractus(b []byte, p, depth int) (int, error) {
+	n, p, err := fractus.ReadVarUint(b, p)
+	if err != nil {
+		return p, err
+	}
+	if n != 2 {
+		return p, fractus.ErrFieldCount
+	}
+	// X
+	if len(b)-p < 4 {
+		return p, fractus.FieldError(p, 0, fractus.ErrTruncated)
+	}
+	x.X = int32(int32(binary.LittleEndian.Uint32(b[p:])))
+	p += 4
+	// Y
+	if len(b)-p < 4 {
+		return p, fractus.FieldError(p, 1, fractus.ErrTruncated)
+	}
+	x.Y = int32(int32(binary.LittleEndian.Uint32(b[p:])))
+	p += 4
+	return p, nil
+}
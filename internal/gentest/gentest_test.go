@@ -0,0 +1,266 @@
+package gentest
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/rawbytedev/fractus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rawOrder has Order's fields and tags but none of its methods, so Fractus
+// encodes it through reflection.
+type rawOrder Order
+
+func sampleOrders() []Order {
+	note := "leave at the door"
+	full := Order{
+		ID:       42,
+		Customer: "ada",
+		Items: []Item{
+			{SKU: "A-1", Qty: 2, Price: 9.5, At: Point{1, -1}},
+			{SKU: "", Qty: 0, Price: math.Copysign(0, -1)},
+		},
+		Tags:    map[string]int32{"b": 2, "a": 1, "c": -3},
+		Hash:    [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Weights: [3]float32{0.5, -1, float32(math.Inf(1))},
+		Note:    &note,
+		Parent:  &Order{ID: 7, Customer: "parent", Status: 3},
+		Status:  2,
+		Count:   -99,
+		Secret:  "never encoded",
+		Blob:    []byte{0, 0xff},
+		Matrix:  [][]float64{{1, 2}, {}, {3}},
+		Flag:    true,
+		Small:   -8,
+		Port:    8080,
+		Delta:   -300,
+		Wait:    1500 * time.Millisecond,
+		Index:   map[[2]uint8][]string{{1, 2}: {"x"}, {0, 9}: {"y", "z"}},
+		Ratio:   0.25,
+		Origin:  Point{X: math.MaxInt32, Y: math.MinInt32},
+		Ref:     UUID{0: 0xde, 15: 0xad},
+		Related: []UUID{{1}, {2}},
+	}
+	return []Order{{}, full, {Ratio: math.Copysign(0, -1), Items: []Item{}}}
+}
+
+func TestGenerated_MatchesReflection(t *testing.T) {
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	for i, o := range sampleOrders() {
+		want, err := f.Encode(rawOrder(o))
+		require.NoError(t, err)
+		want = append([]byte(nil), want...)
+
+		assert.Equal(t, want, o.MarshalFractus(nil), "order %d: generated bytes", i)
+		viaEncode, err := f.Encode(&o)
+		require.NoError(t, err)
+		assert.Equal(t, want, viaEncode, "order %d: Encode should use the generated method", i)
+
+		var got Order
+		require.NoError(t, got.UnmarshalFractus(want))
+		var ref rawOrder
+		require.NoError(t, f.Decode(want, &ref))
+		assert.Equal(t, Order(ref), got, "order %d: generated decode", i)
+	}
+}
+
+// rawEvent is Event without its methods.
+type rawEvent Event
+
+func TestGenerated_Times(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 5, time.FixedZone("", 2*3600))
+	seen := at.UTC().Add(time.Minute)
+	events := []Event{
+		{},
+		{
+			Name:  "deploy",
+			At:    at,
+			Seen:  &seen,
+			Log:   []time.Time{{}, seen, at},
+			Until: time.Unix(0, -1).In(time.FixedZone("", -5*3600)),
+			ByKey: map[string]time.Time{"b": at, "a": {}},
+		},
+	}
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	for i, e := range events {
+		want, err := f.Encode(rawEvent(e))
+		require.NoError(t, err)
+		want = append([]byte(nil), want...)
+		assert.Equal(t, want, e.MarshalFractus(nil), "event %d: generated bytes", i)
+
+		var got Event
+		require.NoError(t, got.UnmarshalFractus(want))
+		var ref rawEvent
+		require.NoError(t, f.Decode(want, &ref))
+		assert.Equal(t, Event(ref), got, "event %d: generated decode", i)
+	}
+
+	// times the format cannot hold fail like they do by reflection
+	far := Event{Log: []time.Time{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	_, err := f.Encode(rawEvent(far))
+	assert.ErrorIs(t, err, fractus.ErrUnsupported)
+	_, err = f.Encode(far)
+	assert.ErrorIs(t, err, fractus.ErrUnsupported)
+	assert.Panics(t, func() { far.MarshalFractus(nil) })
+
+	bad := Event{At: at}.MarshalFractus(nil)
+	bad[bytes.IndexByte(bad, 12)] = 4
+	var got Event
+	genErr := got.UnmarshalFractus(bad)
+	var ref rawEvent
+	refErr := f.Decode(bad, &ref)
+	assert.ErrorIs(t, genErr, fractus.ErrInvalidTime)
+	assert.Equal(t, refErr, genErr)
+}
+
+func TestGenerated_QuickCheck(t *testing.T) {
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	type rawItem Item
+	check := func(it Item) bool {
+		want, err := f.Encode(rawItem(it))
+		if err != nil || !reflect.DeepEqual(want, it.MarshalFractus(nil)) {
+			return false
+		}
+		var got Item
+		return got.UnmarshalFractus(want) == nil && reflect.DeepEqual(got, it)
+	}
+	require.NoError(t, quick.Check(check, nil))
+}
+
+// Generated decoding must fail exactly like the reflective decoder: same
+// error, same offset, same field.
+func TestGenerated_TruncatedMatchesReflection(t *testing.T) {
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	full := sampleOrders()[1]
+	data := full.MarshalFractus(nil)
+	for n := 0; n < len(data); n++ {
+		var got Order
+		genErr := got.UnmarshalFractus(data[:n])
+		var ref rawOrder
+		refErr := f.Decode(data[:n], &ref)
+		require.Error(t, genErr, "prefix %d", n)
+		var de *fractus.DecodeError
+		require.True(t, errors.As(genErr, &de), "prefix %d: %v", n, genErr)
+		assert.Equal(t, refErr.Error(), genErr.Error(), "prefix %d", n)
+	}
+}
+
+func TestGenerated_StrictFieldCount(t *testing.T) {
+	data := Point{X: 1, Y: 2}.MarshalFractus(nil)
+	data[0] = 3
+	var p Point
+	assert.ErrorIs(t, p.UnmarshalFractus(data), fractus.ErrFieldCount)
+}
+
+// Fingerprinted payloads of generated types are checked and stripped
+// before the generated methods see them, by any reader.
+func TestGenerated_Fingerprint(t *testing.T) {
+	full := sampleOrders()[1]
+	// the writers walk Order by reflection and write a fingerprint; a
+	// default reader decodes with the generated methods
+	writers := []fractus.SafeOptions{
+		{Fingerprint: true},
+		{Fingerprint: true, Envelope: true},
+	}
+	for _, opts := range writers {
+		w := fractus.NewFractus(opts)
+		data, err := w.Encode(full)
+		require.NoError(t, err)
+		data = append([]byte(nil), data...)
+		var want Order
+		require.NoError(t, w.Decode(data, &want))
+
+		f := fractus.NewFractus(fractus.SafeOptions{})
+		c, err := fractus.NewCodec[Order](fractus.SafeOptions{})
+		require.NoError(t, err)
+		var got Order
+		require.NoError(t, f.Decode(data, &got), "%+v", opts)
+		assert.Equal(t, want, got, "%+v", opts)
+		got = Order{}
+		require.NoError(t, c.Unmarshal(data, &got), "%+v", opts)
+		assert.Equal(t, want, got, "%+v", opts)
+
+		// a payload of another schema is refused, not misread
+		other := append([]byte(nil), data...)
+		other[bytes.Index(other, []byte{0x81, 0x00})+2] ^= 0xff
+		assert.ErrorIs(t, f.Decode(other, &got), fractus.ErrSchemaMismatch, "%+v", opts)
+		assert.ErrorIs(t, c.Unmarshal(other, &got), fractus.ErrSchemaMismatch, "%+v", opts)
+	}
+
+	// called directly, the generated methods do not take the marker for
+	// a field count
+	data, err := fractus.NewFractus(fractus.SafeOptions{Fingerprint: true}).Encode(Point{X: 42})
+	require.NoError(t, err)
+	var p Point
+	assert.ErrorIs(t, p.UnmarshalFractus(data), fractus.ErrVarintNonCanonical)
+}
+
+func TestGenerated_DefaultMaxDepth(t *testing.T) {
+	// each Parent is two levels deep, a pointer and a struct
+	var chain *Order
+	for range fractus.DefaultMaxDepth / 2 {
+		chain = &Order{Parent: chain}
+	}
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	var got Order
+	require.NoError(t, got.UnmarshalFractus(chain.MarshalFractus(nil)))
+
+	data := Order{Parent: chain}.MarshalFractus(nil)
+	assert.ErrorIs(t, got.UnmarshalFractus(data), fractus.ErrLimitExceeded)
+	assert.ErrorIs(t, f.Decode(data, &got), fractus.ErrLimitExceeded)
+	// the reflective decoder counts the same levels
+	compat := fractus.NewFractus(fractus.SafeOptions{Compatible: true})
+	assert.ErrorIs(t, compat.Decode(data, &got), fractus.ErrLimitExceeded)
+}
+
+// Outside plain compact mode the generated methods do not apply and Fractus
+// walks the struct by reflection, so both types still agree.
+func TestGenerated_OtherModesUseReflection(t *testing.T) {
+	full := sampleOrders()[1]
+	modes := []fractus.SafeOptions{
+		{SelfDescribing: true},
+		{Compatible: true},
+		{OffsetTable: true},
+		{Limits: fractus.DecodeLimits{MaxDepth: 8}},
+		{Checksum: true},
+		{Envelope: true, Checksum: true},
+	}
+	for _, opts := range modes {
+		f := fractus.NewFractus(opts)
+		want, err := f.Encode(rawOrder(full))
+		require.NoError(t, err)
+		want = append([]byte(nil), want...)
+		got, err := f.Encode(full)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "%+v", opts)
+
+		var out Order
+		require.NoError(t, f.Decode(got, &out))
+		var ref rawOrder
+		require.NoError(t, f.Decode(want, &ref))
+		assert.Equal(t, Order(ref), out, "%+v", opts)
+	}
+}
+
+// Generated methods cannot see codecs registered on an instance, so such
+// an instance encodes by reflection and the codec applies.
+func TestGenerated_RegisteredCodecsUseReflection(t *testing.T) {
+	f := fractus.NewFractus(fractus.SafeOptions{})
+	f.RegisterCodec(reflect.TypeFor[UUID](),
+		func(dst []byte, v reflect.Value) ([]byte, error) { return append(dst, 'u'), nil },
+		func(b []byte, v reflect.Value) error { v.Set(reflect.ValueOf(UUID{1})); return nil })
+	data, err := f.Encode(Order{Ref: UUID{9}})
+	require.NoError(t, err)
+	assert.NotEqual(t, Order{Ref: UUID{9}}.MarshalFractus(nil), data)
+
+	var out Order
+	require.NoError(t, f.Decode(data, &out))
+	assert.Equal(t, UUID{1}, out.Ref)
+}
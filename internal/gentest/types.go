@@ -0,0 +1,59 @@
+// Package gentest holds structs whose Fractus methods are generated by
+// cmd/fractusgen. Its tests check the generated code byte for byte against
+// the reflective encoder.
+package gentest
+
+import "time"
+
+//go:generate go run ../../cmd/fractusgen
+
+//fractus:generate
+type Order struct {
+	ID       uint64
+	Customer string `fractus:"customer,id=4"`
+	Items    []Item
+	Tags     map[string]int32
+	Hash     [8]byte
+	Weights  [3]float32
+	Note     *string `fractus:",omitempty"`
+	Parent   *Order  `fractus:",omitempty"`
+	Status   Status
+	Count    int
+	Secret   string `fractus:"-"`
+	Blob     []byte
+	Matrix   [][]float64
+	Flag     bool
+	Small    int8
+	Port     uint16
+	Delta    int16
+	Wait     time.Duration
+	Index    map[[2]uint8][]string
+	Ratio    float64 `fractus:",omitempty"`
+	Origin   Point
+	Ref      UUID
+	Related  []UUID
+	internal int
+}
+
+type Item struct {
+	SKU   string
+	Qty   uint32
+	Price float64
+	At    Point
+}
+
+type Point struct {
+	X, Y int32
+}
+
+type Status int16
+
+//fractus:generate
+type Event struct {
+	Name  string
+	At    time.Time
+	Seen  *time.Time `fractus:",omitempty"`
+	Log   []time.Time
+	Until time.Time `fractus:",omitempty"`
+	ByKey map[string]time.Time
+}
@@ -0,0 +1,76 @@
+// Package tags parses `fractus` struct tags. It is shared by the reflective
+// encoder and cmd/fractusgen so both number fields the same way.
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned when a `fractus` struct tag cannot be parsed. The
+// fractus package exports it as ErrInvalidTag.
+var ErrInvalid = errors.New("invalid fractus tag")
+
+// MaxID bounds explicit field numbers so they always fit in a wire tag
+// alongside the wire kind.
+const MaxID = 1 << 28
+
+// Tag holds the options parsed from a `fractus:"..."` struct tag.
+type Tag struct {
+	Name      string
+	ID        int
+	OmitEmpty bool
+	Skip      bool
+}
+
+// Parse parses the `fractus` tag of the field called name. The tag is a
+// comma separated list whose first element renames the field and whose
+// remaining elements are options:
+//
+//	A int `fractus:"-"`            // never encoded
+//	B int `fractus:"b"`            // recorded under the name "b"
+//	C int `fractus:",omitempty"`   // omitted from the payload when empty
+//	D int `fractus:"d,id=7"`       // stable field number 7
+//	E int `fractus:"id=8"`         // field number 8, name unchanged
+//
+// Fields without an id are numbered one past the previous field, starting
+// at 1, so untagged structs keep their declaration order on the wire.
+func Parse(name string, st reflect.StructTag) (Tag, error) {
+	tag := Tag{Name: name}
+	raw, ok := st.Lookup("fractus")
+	if !ok {
+		return tag, nil
+	}
+	if raw == "-" {
+		tag.Skip = true
+		return tag, nil
+	}
+	parts := strings.Split(raw, ",")
+	// A leading "key=value" element is an option, so `fractus:"id=3"`
+	// works without a leading comma.
+	if !strings.Contains(parts[0], "=") {
+		if parts[0] != "" {
+			tag.Name = parts[0]
+		}
+		parts = parts[1:]
+	}
+	for _, opt := range parts {
+		switch {
+		case opt == "":
+		case opt == "omitempty":
+			tag.OmitEmpty = true
+		case strings.HasPrefix(opt, "id="):
+			id, err := strconv.Atoi(opt[len("id="):])
+			if err != nil || id < 1 || id > MaxID {
+				return tag, fmt.Errorf("%w: bad field id %q", ErrInvalid, opt)
+			}
+			tag.ID = id
+		default:
+			return tag, fmt.Errorf("%w: unknown option %q", ErrInvalid, opt)
+		}
+	}
+	return tag, nil
+}
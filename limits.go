@@ -0,0 +1,72 @@
+package fractus
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is returned when a payload goes over one of the
+// DecodeLimits set in SafeOptions.
+var ErrLimitExceeded = errors.New("decode limit exceeded")
+
+// DefaultMaxDepth is the nesting depth allowed when DecodeLimits.MaxDepth
+// is 0. Decoding recurses once per level, so without a cap a payload
+// nesting a recursive type (struct{ Next *Node }) deeply enough would
+// overflow the stack, which cannot be recovered from.
+const DefaultMaxDepth = 10000
+
+// DecodeLimits bounds the work and memory Decode spends on a payload, for
+// input from untrusted peers. A zero field means no limit, except for
+// MaxDepth, which then defaults to DefaultMaxDepth. Independently of
+// these, counts and lengths are always checked against the remaining input
+// before anything is allocated, so a payload can never ask for more elements
+// than it has bytes.
+type DecodeLimits struct {
+	// MaxBytes is the largest payload accepted. Decoder also applies it
+	// to stream frames.
+	MaxBytes int
+	// MaxElems is the largest number of elements in a slice, or entries
+	// in a map.
+	MaxElems int
+	// MaxString is the longest string accepted, in bytes.
+	MaxString int
+	// MaxDepth is how deeply variable-size values (structs, slices, maps,
+	// pointers and arrays of those) may nest. The fields of the top-level
+	// struct are at depth 1; strings and fixed-size values do not count,
+	// so a flat struct of them passes any limit. 0 means DefaultMaxDepth.
+	MaxDepth int
+}
+
+// over reports whether n goes over limit, where 0 means no limit.
+func over(n, limit int) bool {
+	return limit > 0 && n > limit
+}
+
+// checkBytes applies MaxBytes to a whole payload.
+func (l *DecodeLimits) checkBytes(in []byte) error {
+	if over(len(in), l.MaxBytes) {
+		return decodeErr(l.MaxBytes, -1, fmt.Errorf("%w: payload of %d bytes", ErrLimitExceeded, len(in)))
+	}
+	return nil
+}
+
+// checkDepth applies MaxDepth, or DefaultMaxDepth when it is not set, to a
+// value nesting at depth.
+func (l *DecodeLimits) checkDepth(depth int) error {
+	limit := l.MaxDepth
+	if limit <= 0 {
+		limit = DefaultMaxDepth
+	}
+	if depth > limit {
+		return fmt.Errorf("%w: nested %d deep", ErrLimitExceeded, depth)
+	}
+	return nil
+}
+
+// checkElems applies MaxElems to a slice or map of n elements.
+func (l *DecodeLimits) checkElems(n int) error {
+	if over(n, l.MaxElems) {
+		return fmt.Errorf("%w: %d elements", ErrLimitExceeded, n)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package fractus
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Marshaler is implemented by types that encode themselves. MarshalFractus
+// appends the value's payload to dst and returns the extended slice; it
+// must not fail, so types with invalid states should reject them when
+// they are built.
+//
+// Fields of a Marshaler type are written as a VarInt byte length followed
+// by the payload, in every mode. In self-describing mode they appear as
+// WireBytes fields.
+type Marshaler interface {
+	MarshalFractus(dst []byte) []byte
+}
+
+// Unmarshaler is implemented by types that decode themselves.
+// UnmarshalFractus receives exactly the bytes MarshalFractus produced and
+// must copy them if it keeps them. A *DecodeError it returns is reported
+// at the matching offset of the enclosing input.
+type Unmarshaler interface {
+	UnmarshalFractus(b []byte) error
+}
+
+var (
+	marshalerType   = reflect.TypeFor[Marshaler]()
+	unmarshalerType = reflect.TypeFor[Unmarshaler]()
+)
+
+// customCodec reports whether values of t encode themselves. A type must
+// implement both interfaces (Unmarshaler on its pointer) or neither, since
+// half a codec cannot round-trip. Pointers are never custom themselves;
+// their pointee may be.
+func customCodec(t reflect.Type) (bool, error) {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		return false, nil
+	}
+	pt := reflect.PointerTo(t)
+	m := t.Implements(marshalerType) || pt.Implements(marshalerType)
+	u := pt.Implements(unmarshalerType)
+	if m != u {
+		return false, fmt.Errorf("%w: %s implements only one of Marshaler and Unmarshaler", ErrUnsupported, t)
+	}
+	return m, nil
+}
+
+// delegates reports whether a value with a custom codec is handed to its
+// methods under f's options. Hand-written codecs always are; generated ones
+// only where their bytes equal the reflective encoding.
+func (f *Fractus) delegates(info *FieldInfo) bool {
+	return info.custom && (!info.generated || f.useGenerated())
+}
+
+// topLevel records how f encodes a struct type passed to Encode or Decode.
+// There is no length prefix at the top level: the payload is the whole
+// message.
+type topLevel struct {
+	// codec is set for types with a built-in or registered codec, custom
+	// for types handed to their own methods under f's options.
+	codec  *codec
+	custom bool
+	// opaque is set when the payload is written by a codec or a
+	// hand-written MarshalFractus, in a layout Fractus does not know.
+	// Generated methods keep the reflective layout, so their types are not
+	// opaque.
+	opaque bool
+	// plan is the reflective plan of types that are not opaque.
+	plan *FieldPlan
+}
+
+// top returns the topLevel of struct type t. It is worked out on first use
+// and cached until the next RegisterCodec.
+func (f *Fractus) top(t reflect.Type) (*topLevel, error) {
+	f.mu.RLock()
+	tl, ok := f.tops[t]
+	f.mu.RUnlock()
+	if ok {
+		return tl, nil
+	}
+	tl = &topLevel{codec: f.codecFor(t)}
+	if tl.codec != nil {
+		tl.opaque = true
+	} else {
+		custom, err := customCodec(t)
+		if err != nil {
+			return nil, err
+		}
+		generated := reflect.PointerTo(t).Implements(generatedType)
+		tl.custom = custom && (!generated || f.useGenerated())
+		tl.opaque = custom && !generated
+	}
+	if !tl.opaque {
+		var err error
+		if tl.plan, err = f.getPlan(t); err != nil {
+			return nil, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.tops == nil {
+		f.tops = make(map[reflect.Type]*topLevel)
+	}
+	f.tops[t] = tl
+	return tl, nil
+}
+
+// marshaler returns v as a Marshaler, copying it to the heap when only its
+// pointer implements the interface and v is not addressable.
+func marshaler(v reflect.Value) Marshaler {
+	if m, ok := v.Interface().(Marshaler); ok {
+		return m
+	}
+	if !v.CanAddr() {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface().(Marshaler)
+	}
+	return v.Addr().Interface().(Marshaler)
+}
+
+// marshalValue appends the MarshalFractus payload of v to dst. Generated
+// methods cannot return errors, so they panic with a generatedPanic for
+// values they cannot encode; marshalValue turns that back into an error.
+func marshalValue(dst []byte, v reflect.Value) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			gp, ok := r.(generatedPanic)
+			if !ok {
+				panic(r)
+			}
+			out, err = nil, gp.err
+		}
+	}()
+	return marshaler(v).MarshalFractus(dst), nil
+}
+
+// encodeCustom writes the payload of v's registered codec or Marshaler
+// behind a VarInt byte length.
+func (f *Fractus) encodeCustom(dst []byte, v reflect.Value, info *FieldInfo) ([]byte, error) {
+	start := len(dst)
+	var err error
+	if info.codec != nil {
+		dst, err = info.codec.encode(dst, v)
+	} else {
+		dst, err = marshalValue(dst, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return insertVarUint(dst, start, uint64(len(dst)-start)), nil
+}
+
+// decodeCustom hands the length-prefixed payload at in[pos] to fv's
+// registered codec or UnmarshalFractus. fv is always addressable while
+// decoding.
+func (f *Fractus) decodeCustom(in []byte, pos int, fv reflect.Value, info *FieldInfo) (int, error) {
+	length, next, err := readCountAt(in, pos, 1)
+	if err != nil {
+		return pos, err
+	}
+	end := next + length
+	if info.codec != nil {
+		err = rebase(info.codec.decode(in[next:end:end], fv), next)
+	} else {
+		err = UnmarshalAt(fv.Addr().Interface().(Unmarshaler), in, next, end)
+	}
+	if err != nil {
+		return next, err
+	}
+	return end, nil
+}
+
+// rebase moves a *DecodeError reported for a payload starting at start to
+// its offset in the enclosing input. Other errors are returned as is.
+func rebase(err error, start int) error {
+	if de, ok := err.(*DecodeError); ok {
+		rebased := *de
+		rebased.Offset += start
+		return &rebased
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package plugins
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"slices"
+)
+
+// ErrBadBigInt is returned by DecodeBigInt for payloads EncodeBigInt could
+// not have produced.
+var ErrBadBigInt = errors.New("plugins: malformed big.Int")
+
+// EncodeBigInt encodes a big.Int as a sign byte (0 for x >= 0, 1 for x < 0)
+// followed by the big-endian magnitude. Register it for big.Int; *big.Int
+// fields then get the usual pointer presence byte.
+func EncodeBigInt(dst []byte, v reflect.Value) ([]byte, error) {
+	x := pointer(v).(*big.Int)
+	sign := byte(0)
+	if x.Sign() < 0 {
+		sign = 1
+	}
+	dst = append(dst, sign)
+	n := (x.BitLen() + 7) / 8
+	start := len(dst)
+	dst = slices.Grow(dst, n)[:start+n]
+	x.FillBytes(dst[start:])
+	return dst, nil
+}
+
+// DecodeBigInt decodes the output of EncodeBigInt.
+func DecodeBigInt(b []byte, v reflect.Value) error {
+	if len(b) == 0 || b[0] > 1 {
+		return ErrBadBigInt
+	}
+	x := v.Addr().Interface().(*big.Int)
+	x.SetBytes(b[1:])
+	if b[0] == 1 {
+		x.Neg(x)
+	}
+	return nil
+}
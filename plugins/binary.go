@@ -0,0 +1,53 @@
+package plugins
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+// EncodeBinary encodes types implementing encoding.BinaryMarshaler (or
+// encoding.BinaryAppender), such as netip.Addr, netip.Prefix, url.URL and
+// most decimal libraries.
+func EncodeBinary(dst []byte, v reflect.Value) ([]byte, error) {
+	switch m := pointer(v).(type) {
+	case encoding.BinaryAppender:
+		return m.AppendBinary(dst)
+	case encoding.BinaryMarshaler:
+		b, err := m.MarshalBinary()
+		return append(dst, b...), err
+	}
+	return nil, fmt.Errorf("plugins: %s does not implement encoding.BinaryMarshaler", v.Type())
+}
+
+// DecodeBinary decodes types implementing encoding.BinaryUnmarshaler.
+func DecodeBinary(b []byte, v reflect.Value) error {
+	u, ok := v.Addr().Interface().(encoding.BinaryUnmarshaler)
+	if !ok {
+		return fmt.Errorf("plugins: %s does not implement encoding.BinaryUnmarshaler", v.Type())
+	}
+	return u.UnmarshalBinary(b)
+}
+
+// EncodeText encodes types implementing encoding.TextMarshaler (or
+// encoding.TextAppender). It is larger than EncodeBinary but readable in
+// dumps and supported by more types.
+func EncodeText(dst []byte, v reflect.Value) ([]byte, error) {
+	switch m := pointer(v).(type) {
+	case encoding.TextAppender:
+		return m.AppendText(dst)
+	case encoding.TextMarshaler:
+		b, err := m.MarshalText()
+		return append(dst, b...), err
+	}
+	return nil, fmt.Errorf("plugins: %s does not implement encoding.TextMarshaler", v.Type())
+}
+
+// DecodeText decodes types implementing encoding.TextUnmarshaler.
+func DecodeText(b []byte, v reflect.Value) error {
+	u, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return fmt.Errorf("plugins: %s does not implement encoding.TextUnmarshaler", v.Type())
+	}
+	return u.UnmarshalText(b)
+}
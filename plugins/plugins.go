@@ -0,0 +1,33 @@
+// Package plugins defines the function types used to register custom
+// codecs with fractus.Fractus.RegisterCodec, and ready-made codecs for
+// standard library and third-party types that Fractus cannot encode on its
+// own:
+//
+//	f := fractus.NewFractus(fractus.SafeOptions{})
+//	f.RegisterCodec(reflect.TypeFor[netip.Addr](), plugins.EncodeBinary, plugins.DecodeBinary)
+//	f.RegisterCodec(reflect.TypeFor[big.Int](), plugins.EncodeBigInt, plugins.DecodeBigInt)
+//
+// The package does not import fractus, so codecs can live anywhere.
+package plugins
+
+import "reflect"
+
+// EncodeFunc appends the encoding of v, a value of the registered type, to
+// dst and returns the extended slice.
+type EncodeFunc func(dst []byte, v reflect.Value) ([]byte, error)
+
+// DecodeFunc decodes b, exactly the bytes an EncodeFunc appended, into v,
+// which has the registered type and is settable. b aliases the input and
+// must be copied if kept.
+type DecodeFunc func(b []byte, v reflect.Value) error
+
+// pointer returns a pointer to v's value as an interface, so both value and
+// pointer methods are reachable. Unaddressable values are copied first.
+func pointer(v reflect.Value) any {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
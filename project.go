@@ -0,0 +1,134 @@
+package fractus
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// DecodeFields decodes only the named fields of in into out, a pointer to
+// struct, and leaves the other fields of out untouched. Fields are named as
+// on the wire: by their `fractus` tag name, which defaults to the Go field
+// name. The fields in between are skipped by their length prefixes without
+// being decoded, and decoding stops once every named field has been read.
+// Named fields missing from the payload are zeroed, as with Decode, and an
+// unknown name is rejected with ErrUnknownField before anything is decoded.
+func (f *Fractus) DecodeFields(in []byte, out any, fields ...string) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ErrNotStructPtr
+	}
+	if err := f.Opts.Limits.checkBytes(in); err != nil {
+		return err
+	}
+	dst := v.Elem()
+	t := dst.Type()
+	// generated types keep the reflective layout and can be projected
+	tl, err := f.top(t)
+	if err != nil {
+		return err
+	}
+	if tl.opaque {
+		return fmt.Errorf("%w: cannot decode fields of %s", ErrUnsupported, t)
+	}
+	plan := tl.plan
+	for _, name := range fields {
+		if !slices.ContainsFunc(plan.fields, func(fi FieldInfo) bool { return fi.name == name }) {
+			return fmt.Errorf("%w: %s.%s", ErrUnknownField, t.Name(), name)
+		}
+	}
+	in, base, r, err := f.openFrame(in, false)
+	if err != nil {
+		return err
+	}
+	skip, err := r.readFingerprint(in, t)
+	if err != nil {
+		return rebase(err, base)
+	}
+	in, base = in[skip:], base+skip
+	var pos int
+	if r.Opts.SelfDescribing {
+		pos, err = r.decodeTaggedFields(in, dst, plan, fields)
+	} else {
+		pos, err = r.decodeFieldsOf(in, dst, plan, fields)
+	}
+	if err != nil {
+		return rebase(fieldErr(pos, -1, err), base)
+	}
+	return nil
+}
+
+// decodeFieldsOf is decodeStruct for the fields of plan named in names,
+// skipping the others.
+func (f *Fractus) decodeFieldsOf(in []byte, dst reflect.Value, plan *FieldPlan, names []string) (int, error) {
+	N, bitmap, pos, err := f.readHeader(in, 0, plan)
+	if err != nil {
+		return pos, err
+	}
+	// names may repeat, so count the fields they select
+	left := 0
+	for i := range plan.fields {
+		if slices.Contains(names, plan.fields[i].name) {
+			left++
+		}
+	}
+	for i := 0; i < len(plan.fields) && left > 0; i++ {
+		field := &plan.fields[i]
+		wanted := slices.Contains(names, field.name)
+		if wanted {
+			left--
+		}
+		if uint64(i) >= N || !present(bitmap, i) {
+			if wanted {
+				dst.Field(field.idx).SetZero()
+			}
+			continue
+		}
+		var next int
+		if wanted {
+			next, err = f.decodeValue(in, pos, dst.Field(field.idx), field, 1)
+		} else {
+			next, err = f.skipValue(in, pos, field, 1)
+		}
+		if err != nil {
+			return next, fieldErr(next, field.idx, err)
+		}
+		pos = next
+	}
+	return pos, nil
+}
+
+// decodeTaggedFields is decodeTagged for the fields of plan named in
+// names. Tagged fields carry their own length, so the others cost nothing
+// to skip.
+func (f *Fractus) decodeTaggedFields(in []byte, dst reflect.Value, plan *FieldPlan, names []string) (int, error) {
+	n, pos, err := readCountAt(in, 0, 1)
+	if err != nil {
+		return pos, err
+	}
+	for i := range plan.fields {
+		if slices.Contains(names, plan.fields[i].name) {
+			dst.Field(plan.fields[i].idx).SetZero()
+		}
+	}
+	for ; n > 0; n-- {
+		wf, err := readWireField(in, pos)
+		if err != nil {
+			return wf.end, err
+		}
+		pos = wf.end
+		i, found := slices.BinarySearchFunc(plan.fields, wf.id, func(fi FieldInfo, id int) int { return fi.id - id })
+		if !found || plan.fields[i].wire != wf.wire || !slices.Contains(names, plan.fields[i].name) {
+			continue
+		}
+		field := &plan.fields[i]
+		from := wf.start
+		if selfPrefixed(field) {
+			from = wf.body
+		}
+		if at, err := f.decodeValue(in[:wf.end], from, dst.Field(field.idx), field, 1); err != nil {
+			return at, fieldErr(at, field.idx, err)
+		}
+	}
+	return pos, nil
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package fractus
+
+// raceEnabled reports whether tests run under the race detector, which
+// adds allocations of its own.
+const raceEnabled = true
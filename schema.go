@@ -0,0 +1,399 @@
+package fractus
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidSchema is returned by ParseSchema for malformed schema files.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// Schema describes the wire layout of a struct type and of every struct it
+// contains, for publishing to other teams and languages. It converts to
+// JSON through its field tags and to the .fractus IDL with IDL:
+//
+//	message Order {
+//	  1 ID int64
+//	  2 Items []Item
+//	  3 Tags map[string]int32 omitempty
+//	  4 Total custom(Decimal)
+//	}
+//
+//	message Item {
+//	  1 SKU string
+//	  2 Qty uint16
+//	}
+//
+// Each field line holds the field number, the wire name, the type and the
+// tag options. Types are written as in Go; custom(Name) stands for a type
+// that encodes itself.
+type Schema struct {
+	// Messages lists the top-level struct first, then the structs it
+	// refers to in the order they are first reached.
+	Messages []SchemaMessage `json:"messages"`
+}
+
+// SchemaMessage describes one struct.
+type SchemaMessage struct {
+	Name   string        `json:"name"`
+	Fields []SchemaField `json:"fields"`
+}
+
+// SchemaField describes one field of a struct, as its `fractus` tag does.
+type SchemaField struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Type      SchemaType `json:"type"`
+	OmitEmpty bool       `json:"omitempty,omitempty"`
+}
+
+// SchemaType describes the type of a field or element. Kind is the
+// reflect.Kind name of the type ("int32", "slice", "struct", ...) or
+// "custom" for types that encode themselves.
+type SchemaType struct {
+	Kind string `json:"kind"`
+	// Name is the message of a struct or the Go type name of a custom type.
+	Name string `json:"name,omitempty"`
+	// Len is the length of an array.
+	Len int `json:"len,omitempty"`
+	// Key is the key type of a map.
+	Key *SchemaType `json:"key,omitempty"`
+	// Elem is the element type of a slice, array or map, or the pointee of
+	// a pointer.
+	Elem *SchemaType `json:"elem,omitempty"`
+}
+
+const customKind = "custom"
+
+// SchemaOf returns the Schema of v, a struct or pointer to struct, as
+// Encode lays it out with default options. It returns nil when v is not a
+// struct, encodes itself, or cannot be encoded.
+func SchemaOf(v any) *Schema {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	f := NewFractus(SafeOptions{})
+	tl, err := f.top(t)
+	if err != nil || tl.opaque {
+		return nil
+	}
+	b := schemaBuilder{names: make(map[*FieldPlan]string), taken: make(map[string]bool)}
+	name := t.Name()
+	if name == "" {
+		name = "Message"
+	}
+	b.message(name, tl.plan)
+	return &Schema{Messages: b.messages}
+}
+
+// schemaBuilder collects the messages of a Schema, naming each struct plan
+// once.
+type schemaBuilder struct {
+	messages []SchemaMessage
+	names    map[*FieldPlan]string
+	taken    map[string]bool
+}
+
+// message adds plan under name, or a numbered variant of it when another
+// struct already took the name, and returns the name used. Characters
+// other than letters, digits and underscores, as in the names of generic
+// types, become underscores.
+func (b *schemaBuilder) message(name string, plan *FieldPlan) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	unique := name
+	for n := 2; b.taken[unique]; n++ {
+		unique = name + strconv.Itoa(n)
+	}
+	b.taken[unique] = true
+	b.names[plan] = unique
+	i := len(b.messages)
+	b.messages = append(b.messages, SchemaMessage{Name: unique})
+	fields := make([]SchemaField, len(plan.fields))
+	for j := range plan.fields {
+		field := &plan.fields[j]
+		fields[j] = SchemaField{
+			ID:        field.id,
+			Name:      field.name,
+			Type:      b.typeOf(field, unique+"_"+field.name),
+			OmitEmpty: field.omitEmpty,
+		}
+	}
+	b.messages[i].Fields = fields
+	return unique
+}
+
+// typeOf describes info. Anonymous structs are named after their field,
+// as given by anon.
+func (b *schemaBuilder) typeOf(info *FieldInfo, anon string) SchemaType {
+	if info.custom && !info.generated {
+		return SchemaType{Kind: customKind, Name: info.typ.Name()}
+	}
+	st := SchemaType{Kind: info.kind.String()}
+	switch info.kind {
+	case reflect.Array:
+		st.Len = info.typ.Len()
+		st.Elem = b.ref(info.elem, anon)
+	case reflect.Slice, reflect.Ptr:
+		st.Elem = b.ref(info.elem, anon)
+	case reflect.Map:
+		st.Key = b.ref(info.key, anon+"_key")
+		st.Elem = b.ref(info.elem, anon)
+	case reflect.Struct:
+		name, ok := b.names[info.sub]
+		if !ok {
+			name = info.typ.Name()
+			if name == "" {
+				name = anon
+			}
+			name = b.message(name, info.sub)
+		}
+		st.Name = name
+	}
+	return st
+}
+
+func (b *schemaBuilder) ref(info *FieldInfo, anon string) *SchemaType {
+	st := b.typeOf(info, anon)
+	return &st
+}
+
+// String returns t as written in the IDL.
+func (t SchemaType) String() string {
+	elem := func() string {
+		if t.Elem == nil {
+			return "?"
+		}
+		return t.Elem.String()
+	}
+	switch t.Kind {
+	case customKind:
+		return customKind + "(" + t.Name + ")"
+	case "struct":
+		return t.Name
+	case "slice":
+		return "[]" + elem()
+	case "array":
+		return "[" + strconv.Itoa(t.Len) + "]" + elem()
+	case "ptr":
+		return "*" + elem()
+	case "map":
+		key := "?"
+		if t.Key != nil {
+			key = t.Key.String()
+		}
+		return "map[" + key + "]" + elem()
+	}
+	return t.Kind
+}
+
+// IDL returns s in the .fractus IDL described on Schema.
+func (s *Schema) IDL() []byte {
+	var b bytes.Buffer
+	for i, m := range s.Messages {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "message %s {\n", m.Name)
+		for _, field := range m.Fields {
+			name := field.Name
+			if name == "" || strings.ContainsAny(name, " \t\"{}") {
+				name = strconv.Quote(name)
+			}
+			fmt.Fprintf(&b, "  %d %s %s", field.ID, name, field.Type)
+			if field.OmitEmpty {
+				b.WriteString(" omitempty")
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
+
+// ParseSchema reads a Schema from the .fractus IDL written by Schema.IDL.
+// Blank lines and lines starting with // are ignored. Errors wrap
+// ErrInvalidSchema and give the line they were found on.
+func ParseSchema(idl []byte) (*Schema, error) {
+	s := &Schema{}
+	var current *SchemaMessage
+	line := 0
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: line %d: %s", ErrInvalidSchema, line, fmt.Sprintf(format, args...))
+	}
+	sc := bufio.NewScanner(bytes.NewReader(idl))
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "//"):
+		case current == nil:
+			name, ok := strings.CutPrefix(text, "message ")
+			name, open := strings.CutSuffix(strings.TrimSpace(name), "{")
+			name = strings.TrimSpace(name)
+			if !ok || !open || name == "" || strings.ContainsAny(name, " \t") {
+				return nil, fail("expected \"message Name {\", got %q", text)
+			}
+			if hasMessage(s.Messages, name) {
+				return nil, fail("message %s defined twice", name)
+			}
+			s.Messages = append(s.Messages, SchemaMessage{Name: name, Fields: []SchemaField{}})
+			current = &s.Messages[len(s.Messages)-1]
+		case text == "}":
+			current = nil
+		default:
+			field, err := parseSchemaField(text)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			current.Fields = append(current.Fields, field)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fail("message %s is not closed", current.Name)
+	}
+	for _, m := range s.Messages {
+		for _, field := range m.Fields {
+			if name, ok := undefinedMessage(&field.Type, s.Messages); !ok {
+				return nil, fmt.Errorf("%w: %s.%s refers to undefined message %s", ErrInvalidSchema, m.Name, field.Name, name)
+			}
+		}
+	}
+	return s, nil
+}
+
+// parseSchemaField parses a field line: number, name, type and options.
+func parseSchemaField(text string) (SchemaField, error) {
+	var field SchemaField
+	id, rest, _ := strings.Cut(text, " ")
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 || n > maxFieldID {
+		return field, fmt.Errorf("bad field number %q", id)
+	}
+	field.ID = n
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, `"`) {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return field, fmt.Errorf("bad field name in %q", text)
+		}
+		field.Name, _ = strconv.Unquote(quoted)
+		rest = rest[len(quoted):]
+	} else {
+		field.Name, rest, _ = strings.Cut(rest, " ")
+	}
+	words := strings.Fields(rest)
+	if len(words) == 0 {
+		return field, fmt.Errorf("field %s has no type", field.Name)
+	}
+	typ, tail, err := parseSchemaType(words[0])
+	if err != nil || tail != "" {
+		return field, fmt.Errorf("bad type %q", words[0])
+	}
+	field.Type = typ
+	for _, opt := range words[1:] {
+		if opt != "omitempty" {
+			return field, fmt.Errorf("unknown option %q", opt)
+		}
+		field.OmitEmpty = true
+	}
+	return field, nil
+}
+
+// parseSchemaType parses the type expression at the start of s and
+// returns the rest of s.
+func parseSchemaType(s string) (SchemaType, string, error) {
+	bad := fmt.Errorf("bad type %q", s)
+	switch {
+	case strings.HasPrefix(s, "[]"):
+		elem, rest, err := parseSchemaType(s[2:])
+		return SchemaType{Kind: "slice", Elem: &elem}, rest, err
+	case strings.HasPrefix(s, "["):
+		n, rest, ok := strings.Cut(s[1:], "]")
+		length, err := strconv.Atoi(n)
+		if !ok || err != nil || length < 0 {
+			return SchemaType{}, "", bad
+		}
+		elem, rest, err := parseSchemaType(rest)
+		return SchemaType{Kind: "array", Len: length, Elem: &elem}, rest, err
+	case strings.HasPrefix(s, "*"):
+		elem, rest, err := parseSchemaType(s[1:])
+		return SchemaType{Kind: "ptr", Elem: &elem}, rest, err
+	case strings.HasPrefix(s, "map["):
+		key, rest, err := parseSchemaType(s[len("map["):])
+		if err != nil || !strings.HasPrefix(rest, "]") {
+			return SchemaType{}, "", bad
+		}
+		elem, rest, err := parseSchemaType(rest[1:])
+		return SchemaType{Kind: "map", Key: &key, Elem: &elem}, rest, err
+	case strings.HasPrefix(s, customKind+"("):
+		name, rest, ok := strings.Cut(s[len(customKind)+1:], ")")
+		if !ok || name == "" {
+			return SchemaType{}, "", bad
+		}
+		return SchemaType{Kind: customKind, Name: name}, rest, nil
+	}
+	end := strings.IndexAny(s, "[]*()")
+	if end < 0 {
+		end = len(s)
+	}
+	name, rest := s[:end], s[end:]
+	if name == "" {
+		return SchemaType{}, "", bad
+	}
+	if scalarKind(name) {
+		return SchemaType{Kind: name}, rest, nil
+	}
+	return SchemaType{Kind: "struct", Name: name}, rest, nil
+}
+
+// scalarKind reports whether name is the reflect.Kind name of a scalar
+// Fractus encodes.
+func scalarKind(name string) bool {
+	for k := reflect.Bool; k <= reflect.Float64; k++ {
+		if k.String() == name {
+			return true
+		}
+	}
+	return name == reflect.String.String()
+}
+
+// undefinedMessage returns the first struct t refers to that is not among
+// messages, and false, or true when all are defined.
+func undefinedMessage(t *SchemaType, messages []SchemaMessage) (string, bool) {
+	if t == nil {
+		return "", true
+	}
+	if t.Kind == "struct" && !hasMessage(messages, t.Name) {
+		return t.Name, false
+	}
+	if name, ok := undefinedMessage(t.Key, messages); !ok {
+		return name, false
+	}
+	return undefinedMessage(t.Elem, messages)
+}
+
+func hasMessage(messages []SchemaMessage, name string) bool {
+	return slices.ContainsFunc(messages, func(m SchemaMessage) bool { return m.Name == name })
+}
@@ -0,0 +1,178 @@
+package fractus
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Size returns the exact number of bytes Encode writes for in, a struct or
+// pointer to struct, so that buffers or shared memory slots can be sized
+// up front. Values of types that encode themselves (Marshaler,
+// RegisterCodec, time.Time) are encoded into scratch space to be measured;
+// everything else is measured from its plan without being encoded.
+func (f *Fractus) Size(in any) (int, error) {
+	v := reflect.ValueOf(in)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, ErrNotStruct
+	}
+	tl, err := f.top(v.Type())
+	if err != nil {
+		return 0, err
+	}
+	if tl.codec != nil || tl.custom {
+		n, err := f.measure(v, tl.codec)
+		return n + f.frameOverhead(), err
+	}
+	return f.messageSize(v, tl.plan)
+}
+
+// measure returns the length of the payload of a type that encodes itself,
+// with codec c or, when c is nil, its MarshalFractus method.
+func (f *Fractus) measure(v reflect.Value, c *codec) (int, error) {
+	s := f.getState()
+	defer f.states.Put(s)
+	var buf []byte
+	var err error
+	if c != nil {
+		buf, err = c.encode(s.scratch[:0], v)
+	} else {
+		buf, err = marshalValue(s.scratch[:0], v)
+	}
+	s.keep(buf)
+	return len(buf), err
+}
+
+// messageSize is the size of what encodeMessage writes.
+func (f *Fractus) messageSize(v reflect.Value, plan *FieldPlan) (int, error) {
+	n, err := f.structSize(v, plan)
+	if err == nil && f.Opts.OffsetTable && !f.Opts.SelfDescribing {
+		n += (plan.fieldCount + 1) * offsetWidth
+	}
+	if f.Opts.Fingerprint {
+		n += fingerprintLen
+	}
+	return n + f.frameOverhead(), err
+}
+
+// structSize is the size of what encodeStruct writes.
+func (f *Fractus) structSize(v reflect.Value, plan *FieldPlan) (int, error) {
+	if f.Opts.SelfDescribing {
+		return f.taggedSize(v, plan)
+	}
+	n := varUintLen(uint64(plan.fieldCount))
+	if plan.varCount == 0 && !plan.hasOmit {
+		return n + plan.fixedSize, nil
+	}
+	if plan.hasOmit {
+		n += (plan.fieldCount + 7) / 8
+	}
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		fieldValue := v.Field(field.idx)
+		if field.omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+		m, err := f.valueSize(fieldValue, field)
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+// taggedSize is the size of what encodeTagged writes.
+func (f *Fractus) taggedSize(v reflect.Value, plan *FieldPlan) (int, error) {
+	written, n := 0, 0
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		fieldValue := v.Field(field.idx)
+		if field.omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+		written++
+		m, err := f.valueSize(fieldValue, field)
+		if err != nil {
+			return 0, err
+		}
+		if field.wire == WireBytes && !selfPrefixed(field) {
+			m += varUintLen(uint64(m))
+		}
+		n += varUintLen(uint64(field.id)<<3|uint64(field.wire)) + m
+	}
+	return varUintLen(uint64(written)) + n, nil
+}
+
+// valueSize is the size of what encodeValue writes.
+func (f *Fractus) valueSize(fieldValue reflect.Value, info *FieldInfo) (int, error) {
+	if f.delegates(info) {
+		if fieldValue.CanInterface() {
+			m, err := f.measure(fieldValue, info.codec)
+			return varUintLen(uint64(m)) + m, err
+		}
+		if !info.generated {
+			return 0, fmt.Errorf("%w: %s in unexported field", ErrUnsupported, info.typ)
+		}
+	}
+	if !info.isVar {
+		return info.size, nil
+	}
+	n := 0
+	switch info.kind {
+	case reflect.Array:
+		for i := 0; i < fieldValue.Len(); i++ {
+			m, err := f.valueSize(fieldValue.Index(i), info.elem)
+			if err != nil {
+				return 0, err
+			}
+			n += m
+		}
+		return n, nil
+	case reflect.String:
+		length := fieldValue.Len()
+		return varUintLen(uint64(length)) + length, nil
+	case reflect.Slice:
+		elem := info.elem
+		length := fieldValue.Len()
+		n = varUintLen(uint64(length))
+		if !elem.isVar {
+			return n + length*elem.size, nil
+		}
+		for i := 0; i < length; i++ {
+			m, err := f.valueSize(fieldValue.Index(i), elem)
+			if err != nil {
+				return 0, err
+			}
+			n += m
+		}
+		return n, nil
+	case reflect.Struct:
+		m, err := f.structSize(fieldValue, info.sub)
+		return varUintLen(uint64(m)) + m, err
+	case reflect.Ptr:
+		if fieldValue.IsNil() {
+			return 1, nil
+		}
+		m, err := f.valueSize(fieldValue.Elem(), info.elem)
+		return 1 + m, err
+	case reflect.Map:
+		n = varUintLen(uint64(fieldValue.Len()))
+		iter := fieldValue.MapRange()
+		for iter.Next() {
+			k, err := f.valueSize(iter.Key(), info.key)
+			if err != nil {
+				return 0, err
+			}
+			m, err := f.valueSize(iter.Value(), info.elem)
+			if err != nil {
+				return 0, err
+			}
+			n += k + m
+		}
+		return n, nil
+	}
+	return 0, ErrUnsupported
+}
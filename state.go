@@ -0,0 +1,64 @@
+package fractus
+
+// chunkSize is the size of the memory chunks Encode carves its results
+// from.
+const chunkSize = 8 << 10
+
+// maxFresh is the largest payload a new chunk is started for when it does
+// not fit in what is left of the current one; larger payloads get their
+// own allocation.
+const maxFresh = chunkSize / 8
+
+// maxScratch is the largest scratch buffer a state keeps between calls, so
+// that one large message does not pin that much memory in the pool.
+const maxScratch = 64 << 10
+
+// encState is the per-call state of Encode and Size. States live in the pool of the
+// Fractus, so concurrent calls never share one; everything else an encode
+// touches on the Fractus is either immutable or guarded by its mutex.
+type encState struct {
+	// chunk holds the results already handed out in its length and the
+	// room for the next ones in its capacity. Handed-out bytes are never
+	// written again, so results stay valid for as long as callers keep them.
+	chunk []byte
+	// scratch receives each payload before it is copied out, and the
+	// payloads Size encodes to measure them.
+	scratch []byte
+}
+
+// getState takes a state from the pool, allocating one when it is empty.
+func (f *Fractus) getState() *encState {
+	s, _ := f.states.Get().(*encState)
+	if s == nil {
+		s = new(encState)
+	}
+	return s
+}
+
+// place copies payload into the chunk, starting a new one when it is
+// small and does not fit, or into an allocation of exactly its size, and
+// returns the copy. Handed-out bytes are never written again.
+func (s *encState) place(payload []byte) []byte {
+	n := len(payload)
+	if n > cap(s.chunk)-len(s.chunk) {
+		if n > maxFresh {
+			out := make([]byte, n)
+			copy(out, payload)
+			return out
+		}
+		s.chunk = make([]byte, 0, chunkSize)
+	}
+	start := len(s.chunk)
+	s.chunk = append(s.chunk, payload...)
+	// clip so appending to the result cannot reach the rest of the chunk
+	return s.chunk[start:len(s.chunk):len(s.chunk)]
+}
+
+// keep stores buf, grown from the scratch buffer, for the next call unless
+// it grew past maxScratch.
+func (s *encState) keep(buf []byte) {
+	if cap(buf) > maxScratch {
+		buf = nil
+	}
+	s.scratch = buf[:0]
+}
@@ -0,0 +1,169 @@
+package fractus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ErrFrameTooLarge is returned when a frame, written or announced by a
+// frame header, holds more than MaxFrameSize bytes, or when a Decoder reads
+// a frame over its DecodeLimits.MaxBytes.
+var ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+
+// MaxFrameSize is the largest payload an Encoder or Decoder accepts in one
+// frame.
+const MaxFrameSize = 64 << 20
+
+// An Encoder writes a stream of Fractus messages to an io.Writer. Each
+// message is framed by the varint length of its payload, so a Decoder can
+// read them back one after another. An Encoder is not safe for concurrent
+// use.
+type Encoder struct {
+	w io.Writer
+	f *Fractus
+	// buf holds the frame being written, reused across calls unless it
+	// grew past maxScratch.
+	buf []byte
+}
+
+// NewEncoder returns an Encoder that writes to w with the given options.
+func NewEncoder(w io.Writer, opts SafeOptions) *Encoder {
+	return NewFractus(opts).NewEncoder(w)
+}
+
+// NewEncoder returns an Encoder that writes to w with f, including the
+// codecs registered on it.
+func (f *Fractus) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, f: f}
+}
+
+// Encode writes the encoding of v, a struct or pointer to struct, as one
+// frame with a single call to Write. Payloads over MaxFrameSize are
+// rejected with ErrFrameTooLarge before anything is written.
+func (e *Encoder) Encode(v any) error {
+	// The payload goes after room for the longest header, which is then
+	// written right before it once the length is known.
+	if cap(e.buf) < maxVarintLen64 {
+		e.buf = make([]byte, maxVarintLen64, 512)
+	}
+	buf, err := e.f.AppendEncode(e.buf[:maxVarintLen64], v)
+	if err != nil {
+		return err
+	}
+	// one large message must not pin its buffer for the Encoder's life
+	e.buf = buf
+	if cap(buf) > maxScratch {
+		e.buf = nil
+	}
+	n := len(buf) - maxVarintLen64
+	if n > MaxFrameSize {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+	var hdr [maxVarintLen64]byte
+	h := writeVarUint(hdr[:0], uint64(n))
+	start := maxVarintLen64 - len(h)
+	copy(buf[start:], h)
+	_, err = e.w.Write(buf[start:])
+	return err
+}
+
+// A Decoder reads the Fractus messages written by an Encoder from an
+// io.Reader. It buffers its input when r is not an io.ByteReader, so it
+// may read past the last frame it returns. A Decoder is not safe for
+// concurrent use.
+type Decoder struct {
+	r  io.Reader
+	br io.ByteReader
+	f  *Fractus
+	// buf holds the current frame. It is only reused when the options
+	// guarantee that decoded values do not alias it, and not once it grew
+	// past maxScratch.
+	buf []byte
+}
+
+// NewDecoder returns a Decoder that reads from r with the given options.
+func NewDecoder(r io.Reader, opts SafeOptions) *Decoder {
+	return NewFractus(opts).NewDecoder(r)
+}
+
+// NewDecoder returns a Decoder that reads from r with f, including the
+// codecs registered on it.
+func (f *Fractus) NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		b := bufio.NewReader(r)
+		r, br = b, b
+	}
+	return &Decoder{r: r, br: br, f: f}
+}
+
+// Decode reads the next frame into out, a pointer to struct. It returns
+// io.EOF when the stream ends cleanly between frames and
+// io.ErrUnexpectedEOF when it ends inside one. Frame contents are checked
+// like the input of Fractus.Decode, with offsets relative to the payload.
+func (d *Decoder) Decode(out any) error {
+	n, err := d.readLen()
+	if err != nil {
+		return err
+	}
+	if n > MaxFrameSize || over(int(n), d.f.Opts.Limits.MaxBytes) {
+		return fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+	if d.f.Opts.UnsafeStrings || d.f.Opts.UnsafePrimitives {
+		// decoded values may point into the frame; leave it to them
+		d.buf = nil
+	}
+	if err := d.readFrame(int(n)); err != nil {
+		return err
+	}
+	err = d.f.Decode(d.buf, out)
+	if cap(d.buf) > maxScratch {
+		d.buf = nil
+	}
+	return err
+}
+
+// readLen reads a frame header.
+func (d *Decoder) readLen() (uint64, error) {
+	var x uint64
+	for i := 0; i < maxVarintLen64; i++ {
+		c, err := d.br.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if c < 0x80 {
+			if i == maxVarintLen64-1 && c > 1 {
+				return 0, ErrVarintOverflow
+			}
+			return x | uint64(c)<<(7*i), nil
+		}
+		x |= uint64(c&0x7F) << (7 * i)
+	}
+	return 0, ErrVarintOverflow
+}
+
+// readFrame reads the n-byte payload of a frame into d.buf. The buffer
+// grows with the data actually read, so a corrupt header cannot force a
+// large allocation up front.
+func (d *Decoder) readFrame(n int) error {
+	d.buf = d.buf[:0]
+	for len(d.buf) < n {
+		step := min(n-len(d.buf), max(len(d.buf), 4<<10))
+		d.buf = slices.Grow(d.buf, step)
+		m, err := io.ReadFull(d.r, d.buf[len(d.buf):len(d.buf)+step])
+		d.buf = d.buf[:len(d.buf)+m]
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
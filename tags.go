@@ -0,0 +1,27 @@
+package fractus
+
+import (
+	"reflect"
+
+	"github.com/rawbytedev/fractus/internal/tags"
+)
+
+// ErrInvalidTag is returned when a `fractus` struct tag cannot be parsed or
+// assigns a field number that is already taken.
+var ErrInvalidTag = tags.ErrInvalid
+
+// maxFieldID bounds explicit field numbers so they always fit in a
+// wire tag alongside the wire kind.
+const maxFieldID = tags.MaxID
+
+// isEmptyValue reports whether an `omitempty` field holding v is left out of
+// the payload: empty strings, slices and maps, nil pointers and zero values
+// of every other kind.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
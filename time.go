@@ -0,0 +1,91 @@
+package fractus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// ErrInvalidTime is returned when a time.Time payload has an impossible
+// length or zone offset.
+var ErrInvalidTime = errors.New("invalid time payload")
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// Times outside [minNanoTime, maxNanoTime] do not fit int64 unix
+// nanoseconds and are rejected rather than silently wrapped.
+var (
+	minNanoTime = time.Unix(0, math.MinInt64)
+	maxNanoTime = time.Unix(0, math.MaxInt64)
+)
+
+// maxZoneOffset bounds decoded zone offsets, in seconds.
+const maxZoneOffset = 24 * 60 * 60
+
+// encodeTime writes a time.Time field of v; see appendTime.
+func (f *Fractus) encodeTime(dst []byte, v reflect.Value) ([]byte, error) {
+	return appendTime(dst, timeOf(v), f.Opts.UTCTimes)
+}
+
+// decodeTime reads the payload written by encodeTime into v.
+func (f *Fractus) decodeTime(b []byte, v reflect.Value) error {
+	t, err := parseTime(b, f.Opts.UTCTimes)
+	if err != nil {
+		return err
+	}
+	*(*time.Time)(v.Addr().UnsafePointer()) = t
+	return nil
+}
+
+// appendTime writes t as nothing for the zero time, otherwise as 8 bytes
+// of unix nanoseconds followed, for times outside UTC and unless utc is
+// set, by the 4-byte zone offset in seconds. Zone names are not kept;
+// decoded times carry a fixed zone with the same offset.
+func appendTime(dst []byte, t time.Time, utc bool) ([]byte, error) {
+	if t.IsZero() {
+		return dst, nil
+	}
+	if t.Before(minNanoTime) || t.After(maxNanoTime) {
+		return nil, fmt.Errorf("%w: time %v is outside the unix nanosecond range", ErrUnsupported, t)
+	}
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(t.UnixNano()))
+	if !utc && t.Location() != time.UTC {
+		_, offset := t.Zone()
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(int32(offset)))
+	}
+	return dst, nil
+}
+
+// parseTime reads the payload written by appendTime, dropping the zone
+// offset when utc is set.
+func parseTime(b []byte, utc bool) (time.Time, error) {
+	var t time.Time
+	switch len(b) {
+	case 0:
+	case 8, 12:
+		t = time.Unix(0, int64(binary.LittleEndian.Uint64(b))).UTC()
+		if len(b) == 12 {
+			offset := int(int32(binary.LittleEndian.Uint32(b[8:])))
+			if offset <= -maxZoneOffset || offset >= maxZoneOffset {
+				return time.Time{}, ErrInvalidTime
+			}
+			if !utc {
+				t = t.In(time.FixedZone("", offset))
+			}
+		}
+	default:
+		return time.Time{}, ErrInvalidTime
+	}
+	return t, nil
+}
+
+// timeOf reads the time.Time held by v without boxing it when possible.
+func timeOf(v reflect.Value) time.Time {
+	if v.CanAddr() {
+		return *(*time.Time)(v.Addr().UnsafePointer())
+	}
+	return v.Interface().(time.Time)
+}
@@ -0,0 +1,85 @@
+package fractus
+
+import "reflect"
+
+// Codec encodes and decodes values of the struct type T. How T is encoded
+// is resolved once by NewCodec, so unsupported types fail there and calls
+// skip the interface conversion and kind checks of Encode and Decode.
+//
+// A Codec is safe for concurrent use, like the Fractus it encodes with.
+type Codec[T any] struct {
+	f  *Fractus
+	tl *topLevel
+}
+
+// NewCodec returns a Codec for T. It fails with ErrNotStruct when T is not
+// a struct and with ErrUnsupported when T has fields Fractus cannot encode.
+func NewCodec[T any](opts SafeOptions) (*Codec[T], error) {
+	return NewCodecFor[T](NewFractus(opts))
+}
+
+// NewCodecFor is like NewCodec but encodes with f, so that codecs added
+// with f.RegisterCodec apply. Register them before calling NewCodecFor:
+// the Codec keeps the encoding it resolves here.
+func NewCodecFor[T any](f *Fractus) (*Codec[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+	tl, err := f.top(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec[T]{f: f, tl: tl}, nil
+}
+
+// Marshal returns the encoding of *v in a newly allocated slice, which the
+// caller owns.
+func (c *Codec[T]) Marshal(v *T) ([]byte, error) {
+	if v == nil {
+		return nil, ErrNotStructPtr
+	}
+	s := c.f.getState()
+	defer c.f.states.Put(s)
+	payload, err := c.f.encodeScratch(s, reflect.ValueOf(v).Elem(), c.tl)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(payload))
+	copy(out, payload)
+	return out, nil
+}
+
+// Size returns the exact length of the encoding of *v; see Fractus.Size.
+func (c *Codec[T]) Size(v *T) (int, error) {
+	if v == nil {
+		return 0, ErrNotStructPtr
+	}
+	if c.tl.codec != nil || c.tl.custom {
+		return c.f.Size(v)
+	}
+	return c.f.messageSize(reflect.ValueOf(v).Elem(), c.tl.plan)
+}
+
+// AppendMarshal appends the encoding of *v to dst and returns the extended
+// slice. On error dst is returned unchanged.
+func (c *Codec[T]) AppendMarshal(dst []byte, v *T) ([]byte, error) {
+	if v == nil {
+		return dst, ErrNotStructPtr
+	}
+	return c.f.encodeTop(dst, reflect.ValueOf(v).Elem(), c.tl)
+}
+
+// Unmarshal decodes b into *v. Errors are reported like Decode's.
+func (c *Codec[T]) Unmarshal(b []byte, v *T) error {
+	if v == nil {
+		return ErrNotStructPtr
+	}
+	return c.f.decodeFramed(b, reflect.ValueOf(v).Elem(), c.tl)
+}
+
+// View returns a View of b, an encoding of T, to read single fields
+// without decoding the rest; see Fractus.NewView.
+func (c *Codec[T]) View(b []byte) (View, error) {
+	return c.f.NewView(b, reflect.TypeFor[T]())
+}
@@ -13,6 +13,7 @@ func isFixedKind(k reflect.Kind) bool {
 	case reflect.Bool,
 		reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Int, reflect.Uint, reflect.Uintptr,
 		reflect.Float32, reflect.Float64:
 		return true
 	default:
@@ -22,7 +23,8 @@ func isFixedKind(k reflect.Kind) bool {
 
 func FixedSize(k reflect.Kind) int {
 	// FixedSize returns the byte width for fixed-size primitive kinds.
-	// Returns -1 for non-fixed kinds.
+	// Returns -1 for non-fixed kinds. Platform-width int, uint and uintptr
+	// are always 8 bytes on the wire so payloads are portable.
 	switch k {
 	case reflect.Bool, reflect.Int8, reflect.Uint8:
 		return 1
@@ -30,7 +32,8 @@ func FixedSize(k reflect.Kind) int {
 		return 2
 	case reflect.Int32, reflect.Uint32, reflect.Float32:
 		return 4
-	case reflect.Int64, reflect.Uint64, reflect.Float64:
+	case reflect.Int64, reflect.Uint64, reflect.Float64,
+		reflect.Int, reflect.Uint, reflect.Uintptr:
 		return 8
 	default:
 		return -1
@@ -46,47 +49,45 @@ func writeVarUint(buf []byte, x uint64) []byte {
 	return append(buf, byte(x))
 }
 
-// set fields using unsafe
-func setUnsafeFixed(dst reflect.Value, b []byte, k reflect.Kind, sliceLen int) {
-	switch k {
-	case reflect.Bool:
-		val := unsafe.Slice((*bool)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Int8:
-		val := unsafe.Slice((*int8)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Uint8:
-		val := unsafe.Slice((*uint8)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Int16:
-		val := unsafe.Slice((*int16)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Uint16:
-		val := unsafe.Slice((*uint16)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Int32:
-		val := unsafe.Slice((*int32)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Uint32:
-		val := unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Int64:
-		val := unsafe.Slice((*int64)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Uint64:
-		val := unsafe.Slice((*uint64)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Float32:
-		val := unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
-	case reflect.Float64:
-		val := unsafe.Slice((*float64)(unsafe.Pointer(&b[0])), sliceLen)
-		dst.Set(reflect.ValueOf(val))
+// varUintLen returns the number of bytes writeVarUint uses for x.
+func varUintLen(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+// insertVarUint inserts the varint encoding of x at buf[at], shifting the
+// bytes after it. It is used to length-prefix nested values whose size is
+// only known once they have been written.
+func insertVarUint(buf []byte, at int, x uint64) []byte {
+	n := varUintLen(x)
+	end := len(buf)
+	for i := 0; i < n; i++ {
+		buf = append(buf, 0)
 	}
+	copy(buf[at+n:], buf[at:end])
+	writeVarUint(buf[at:at], x)
+	return buf
 }
-func setFixed(dst reflect.Value, b []byte, k reflect.Kind) {
+
+// set fields using unsafe
+// setUnsafeFixed points the slice dst at the first sliceLen elements stored
+// in b without copying. The element type must have the same memory layout as
+// its wire encoding (see FieldInfo.native).
+func setUnsafeFixed(dst reflect.Value, b []byte, sliceLen int) {
+	dst.Set(reflect.SliceAt(dst.Type().Elem(), unsafe.Pointer(&b[0]), sliceLen))
+}
+
+func setFixed(dst reflect.Value, b []byte, k reflect.Kind) error {
 	// setFixed decodes a fixed-size primitive value from b and sets dst.
-	// It expects b to be at least the appropriate width for k.
+	// It returns ErrTruncated when b is shorter than the width of k, and
+	// ErrIntOverflow when a platform-width integer does not fit in dst
+	// (e.g. a large value decoded on a 32-bit platform).
+	if len(b) < FixedSize(k) {
+		return ErrTruncated
+	}
 	switch k {
 	case reflect.Bool:
 		dst.SetBool(b[0] != 0)
@@ -106,25 +107,93 @@ func setFixed(dst reflect.Value, b []byte, k reflect.Kind) {
 		dst.SetInt(int64(binary.LittleEndian.Uint64(b)))
 	case reflect.Uint64:
 		dst.SetUint(binary.LittleEndian.Uint64(b))
+	case reflect.Int:
+		x := int64(binary.LittleEndian.Uint64(b))
+		if dst.OverflowInt(x) {
+			return ErrIntOverflow
+		}
+		dst.SetInt(x)
+	case reflect.Uint, reflect.Uintptr:
+		x := binary.LittleEndian.Uint64(b)
+		if dst.OverflowUint(x) {
+			return ErrIntOverflow
+		}
+		dst.SetUint(x)
 	case reflect.Float32:
 		dst.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
 	case reflect.Float64:
 		dst.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(b)))
 	}
+	return nil
 }
 
+// maxVarintLen64 is the maximum number of bytes a 64-bit varint occupies.
+const maxVarintLen64 = 10
+
 func readVarUint(b []byte) (uint64, int) {
 	// readVarUint decodes a varint from the front of b returning the value
 	// and the number of bytes consumed. If b does not contain a full varint,
-	// returns (0, 0).
+	// returns (0, 0). If the varint overflows 64 bits, returns (0, -n) where
+	// n is the number of bytes read.
 	var x uint64
 	var s uint
 	for i, c := range b {
-		x |= uint64(c&0x7F) << s
-		if c&0x80 == 0 {
-			return x, i + 1
+		if i == maxVarintLen64 {
+			return 0, -(i + 1)
 		}
+		if c < 0x80 {
+			if i == maxVarintLen64-1 && c > 1 {
+				return 0, -(i + 1)
+			}
+			return x | uint64(c)<<s, i + 1
+		}
+		x |= uint64(c&0x7F) << s
 		s += 7
 	}
 	return 0, 0
 }
+
+// readVarUintAt decodes the varint starting at in[pos], returning the value
+// and the position just past it.
+func readVarUintAt(in []byte, pos int) (uint64, int, error) {
+	x, n := readVarUint(in[pos:])
+	if n == 0 {
+		return 0, pos, ErrTruncated
+	}
+	if n < 0 {
+		return 0, pos, ErrVarintOverflow
+	}
+	return x, pos + n, nil
+}
+
+// checkCanonical rejects the varint at in[pos] when it takes more bytes
+// than writeVarUint would, as the frame markers of checksum.go and
+// fingerprint.go do. Truncated and overlong varints are left to
+// readVarUintAt.
+func checkCanonical(in []byte, pos int) error {
+	i := pos
+	for i < len(in) && in[i] >= 0x80 {
+		i++
+	}
+	if i > pos && i < len(in) && in[i] == 0 {
+		return ErrVarintNonCanonical
+	}
+	return nil
+}
+
+// readCountAt reads a length/count prefix at in[pos] and checks that `count`
+// items of at least `width` bytes each fit in the remaining input, so callers
+// can slice or allocate without further checks.
+func readCountAt(in []byte, pos, width int) (int, int, error) {
+	x, next, err := readVarUintAt(in, pos)
+	if err != nil {
+		return 0, pos, err
+	}
+	if width < 1 {
+		width = 1
+	}
+	if x > uint64(len(in)-next)/uint64(width) {
+		return 0, pos, ErrLengthTooLarge
+	}
+	return int(x), next, nil
+}
@@ -0,0 +1,408 @@
+package fractus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"unsafe"
+)
+
+var (
+	// ErrUnknownField is returned when a field is asked for that the
+	// struct does not encode: out of range, unexported or tagged "-".
+	ErrUnknownField = errors.New("unknown field")
+	// ErrKindMismatch is returned by View accessors called on a field of
+	// another kind, e.g. String on an int field.
+	ErrKindMismatch = errors.New("field kind mismatch")
+)
+
+// offsetWidth is the size of one offset table entry.
+const offsetWidth = 4
+
+// A View reads single fields of an encoded struct in place, without
+// decoding the rest of the payload. Fields are located on first use: a
+// View walks the fields before the one asked for by skipping over their
+// length prefixes, remembering how far it got, or looks the field up
+// directly when the payload has an offset table (SafeOptions.OffsetTable).
+//
+// Fields are identified by their index in the Go struct, as for
+// reflect.Type.Field and DecodeError.Field. Fields missing from the payload
+// read as zero values. Strings and byte slices returned by a View alias the
+// payload, which must not be modified while they are in use.
+type View struct {
+	f    *Fractus
+	in   []byte
+	plan *FieldPlan
+	// n is the number of fields in the payload, body the position of the
+	// first one and bitmap the presence bitmap of compact payloads.
+	n      int
+	body   int
+	bitmap []byte
+	// table holds one offset per payload field when the payload carries
+	// an offset table.
+	table []byte
+	// at and pos cache the walk: field at (a plan position) starts at pos.
+	at, pos int
+}
+
+// NewView returns a View of in, an encoding of a struct of type t (or a
+// pointer to one). Only the header is read; fields are checked when they
+// are accessed. Types that encode themselves (Marshaler, RegisterCodec)
+// cannot be viewed.
+func (f *Fractus) NewView(in []byte, t reflect.Type) (View, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return View{}, ErrNotStruct
+	}
+	// generated types keep the reflective layout and can be viewed
+	tl, err := f.top(t)
+	if err != nil {
+		return View{}, err
+	}
+	if tl.opaque {
+		return View{}, fmt.Errorf("%w: cannot view %s", ErrUnsupported, t)
+	}
+	plan := tl.plan
+	if err := f.Opts.Limits.checkBytes(in); err != nil {
+		return View{}, err
+	}
+	// The view keeps the envelope or checksum marker, if any, so that
+	// offsets stay relative to the start of the payload.
+	body, base, r, err := f.openFrame(in, false)
+	if err != nil {
+		return View{}, err
+	}
+	skip, err := r.readFingerprint(body, t)
+	if err != nil {
+		return View{}, rebase(err, base)
+	}
+	in, base = in[:base+len(body)], base+skip
+	v := View{f: r, in: in, plan: plan}
+	if r.Opts.SelfDescribing {
+		n, pos, err := readCountAt(in, base, 1)
+		if err != nil {
+			return View{}, decodeErr(pos, -1, err)
+		}
+		v.n, v.body = n, pos
+		return v, nil
+	}
+	n, bitmap, pos, err := r.readHeader(in, base, plan)
+	if err != nil {
+		return View{}, decodeErr(pos, -1, err)
+	}
+	v.n, v.body, v.bitmap = int(n), pos, bitmap
+	if r.Opts.OffsetTable {
+		if err := v.readTable(); err != nil {
+			return View{}, err
+		}
+	}
+	v.at, v.pos = 0, v.body
+	return v, nil
+}
+
+// readTable splits the offset table off the end of the payload: one
+// little-endian uint32 per field holding the offset of its first byte,
+// then the number of entries.
+func (v *View) readTable() error {
+	size := (v.n + 1) * offsetWidth
+	if v.n > len(v.in)/offsetWidth || len(v.in)-v.body < size {
+		return decodeErr(len(v.in), -1, ErrTruncated)
+	}
+	end := len(v.in) - size
+	trailer := v.in[len(v.in)-offsetWidth:]
+	if int(binary.LittleEndian.Uint32(trailer)) != v.n {
+		return decodeErr(len(v.in)-offsetWidth, -1, ErrFieldCount)
+	}
+	v.table = v.in[end : len(v.in)-offsetWidth]
+	// fields cannot reach into the table
+	v.in = v.in[:end]
+	return nil
+}
+
+// Int64 returns signed integer field i.
+func (v *View) Int64(i int) (int64, error) {
+	b, field, err := v.fixed(i, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	switch field.size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+// Uint64 returns unsigned integer field i.
+func (v *View) Uint64(i int) (uint64, error) {
+	b, field, err := v.fixed(i, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	switch field.size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b)), nil
+	default:
+		return binary.LittleEndian.Uint64(b), nil
+	}
+}
+
+// Float64 returns floating-point field i.
+func (v *View) Float64(i int) (float64, error) {
+	b, field, err := v.fixed(i, reflect.Float32, reflect.Float64)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	if field.size == 4 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+// Bool returns boolean field i.
+func (v *View) Bool(i int) (bool, error) {
+	b, _, err := v.fixed(i, reflect.Bool)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return b[0] != 0, nil
+}
+
+// String returns string field i. The result aliases the payload.
+func (v *View) String(i int) (string, error) {
+	b, err := v.bytes(i, false)
+	if err != nil || len(b) == 0 {
+		return "", err
+	}
+	return unsafe.String(&b[0], len(b)), nil
+}
+
+// Bytes returns []byte field i, or the bytes of string field i. The result
+// aliases the payload.
+func (v *View) Bytes(i int) ([]byte, error) {
+	return v.bytes(i, true)
+}
+
+// fixed locates fixed-size field i, which must have one of kinds, and
+// returns its bytes, or nil if the field is not in the payload.
+func (v *View) fixed(i int, kinds ...reflect.Kind) ([]byte, *FieldInfo, error) {
+	field, pos, err := v.locate(i)
+	if err != nil {
+		return nil, field, err
+	}
+	if !slices.Contains(kinds, field.kind) || field.custom {
+		return nil, field, fmt.Errorf("%w: field %d is %s", ErrKindMismatch, i, field.typ)
+	}
+	if pos < 0 {
+		return nil, field, nil
+	}
+	if len(v.in)-pos < field.size {
+		return nil, field, decodeErr(pos, field.idx, ErrTruncated)
+	}
+	return v.in[pos : pos+field.size : pos+field.size], field, nil
+}
+
+// bytes locates string field i, or []byte field i when byteSlice is set,
+// and returns its payload.
+func (v *View) bytes(i int, byteSlice bool) ([]byte, error) {
+	field, pos, err := v.locate(i)
+	if err != nil {
+		return nil, err
+	}
+	ok := field.kind == reflect.String ||
+		byteSlice && field.kind == reflect.Slice && field.elem.kind == reflect.Uint8 && !field.elem.custom
+	if !ok || field.custom {
+		return nil, fmt.Errorf("%w: field %d is %s", ErrKindMismatch, i, field.typ)
+	}
+	if pos < 0 {
+		return nil, nil
+	}
+	n, next, err := readCountAt(v.in, pos, 1)
+	if err != nil {
+		return nil, decodeErr(pos, field.idx, err)
+	}
+	return v.in[next : next+n : next+n], nil
+}
+
+// locate returns the description of struct field i and the position of
+// its value, or -1 when the payload does not hold it.
+func (v *View) locate(i int) (*FieldInfo, int, error) {
+	p := v.plan.position(i)
+	if p < 0 {
+		return nil, -1, fmt.Errorf("%w: %d", ErrUnknownField, i)
+	}
+	field := &v.plan.fields[p]
+	if v.f.Opts.SelfDescribing {
+		pos, err := v.locateTagged(field)
+		return field, pos, err
+	}
+	if p >= v.n || !present(v.bitmap, p) {
+		return field, -1, nil
+	}
+	if v.table != nil {
+		pos := int(binary.LittleEndian.Uint32(v.table[p*offsetWidth:]))
+		if pos < v.body || pos > len(v.in) {
+			return field, -1, decodeErr(len(v.in)+p*offsetWidth, -1, ErrLengthTooLarge)
+		}
+		return field, pos, nil
+	}
+	if p < v.at {
+		v.at, v.pos = 0, v.body
+	}
+	for ; v.at < p; v.at++ {
+		if !present(v.bitmap, v.at) {
+			continue
+		}
+		skipped := &v.plan.fields[v.at]
+		next, err := v.f.skipValue(v.in, v.pos, skipped, 1)
+		if err != nil {
+			return field, -1, fieldErr(next, skipped.idx, err)
+		}
+		v.pos = next
+	}
+	return field, v.pos, nil
+}
+
+// position returns the plan position of struct field idx, or -1 if the
+// plan does not encode it.
+func (p *FieldPlan) position(idx int) int {
+	for i := range p.fields {
+		if p.fields[i].idx == idx {
+			return i
+		}
+	}
+	return -1
+}
+
+// locateTagged finds field in a self-describing payload. A field written
+// with another wire kind is ignored, as Decode does.
+func (v *View) locateTagged(field *FieldInfo) (int, error) {
+	pos := v.body
+	for j := 0; j < v.n; j++ {
+		wf, err := readWireField(v.in, pos)
+		if err != nil {
+			return -1, decodeErr(wf.end, -1, err)
+		}
+		if wf.id == field.id && wf.wire == field.wire {
+			if selfPrefixed(field) {
+				return wf.body, nil
+			}
+			return wf.start, nil
+		}
+		pos = wf.end
+	}
+	return -1, nil
+}
+
+// skipValue returns the position just past the compact encoding of a value
+// described by info at in[pos], nested depth deep, reading only length
+// prefixes, counts and presence markers.
+func (f *Fractus) skipValue(in []byte, pos int, info *FieldInfo, depth int) (int, error) {
+	// custom types, strings and structs all start with their byte length
+	if selfPrefixed(info) {
+		n, next, err := readCountAt(in, pos, 1)
+		if err != nil {
+			return pos, err
+		}
+		return next + n, nil
+	}
+	if !info.isVar {
+		if len(in)-pos < info.size {
+			return pos, ErrTruncated
+		}
+		return pos + info.size, nil
+	}
+	if err := f.Opts.Limits.checkDepth(depth); err != nil {
+		return pos, err
+	}
+	var err error
+	switch info.kind {
+	case reflect.Array:
+		for i := 0; i < info.typ.Len(); i++ {
+			if pos, err = f.skipValue(in, pos, info.elem, depth+1); err != nil {
+				return pos, err
+			}
+		}
+		return pos, nil
+	case reflect.Slice:
+		elem := info.elem
+		count, next, err := readCountAt(in, pos, elem.minWireSize())
+		if err != nil {
+			return pos, err
+		}
+		if !elem.isVar {
+			// readCountAt checked that count fixed elements fit
+			return next + count*elem.size, nil
+		}
+		pos = next
+		for i := 0; i < count; i++ {
+			if pos, err = f.skipValue(in, pos, elem, depth+1); err != nil {
+				return pos, err
+			}
+		}
+		return pos, nil
+	case reflect.Ptr:
+		if pos >= len(in) {
+			return pos, ErrTruncated
+		}
+		switch in[pos] {
+		case 0:
+			return pos + 1, nil
+		case 1:
+			return f.skipValue(in, pos+1, info.elem, depth+1)
+		default:
+			return pos, ErrInvalidPresence
+		}
+	case reflect.Map:
+		count, next, err := readCountAt(in, pos, info.key.minWireSize()+info.elem.minWireSize())
+		if err != nil {
+			return pos, err
+		}
+		pos = next
+		for i := 0; i < count; i++ {
+			if pos, err = f.skipValue(in, pos, info.key, depth+1); err != nil {
+				return pos, err
+			}
+			if pos, err = f.skipValue(in, pos, info.elem, depth+1); err != nil {
+				return pos, err
+			}
+		}
+		return pos, nil
+	}
+	return pos, ErrUnsupported
+}
+
+// appendOffsetTable appends the offset table of the compact struct encoded
+// at b[start:] (see View.readTable).
+func (f *Fractus) appendOffsetTable(b []byte, start, body int, plan *FieldPlan) ([]byte, error) {
+	msg := b[start:]
+	if len(msg) > math.MaxUint32 {
+		return b, fmt.Errorf("%w: %d bytes do not fit an offset table", ErrLengthTooLarge, len(msg))
+	}
+	n, bitmap, pos, err := f.readHeader(msg, body-start, plan)
+	if err != nil {
+		return b, err
+	}
+	for i := 0; i < int(n); i++ {
+		b = binary.LittleEndian.AppendUint32(b, uint32(pos))
+		if present(bitmap, i) {
+			if pos, err = f.skipValue(msg, pos, &plan.fields[i], 1); err != nil {
+				return b, err
+			}
+		}
+	}
+	return binary.LittleEndian.AppendUint32(b, uint32(n)), nil
+}
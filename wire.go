@@ -0,0 +1,211 @@
+package fractus
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+)
+
+// ErrInvalidWireKind is returned when a self-describing field tag carries a
+// wire kind this version of Fractus does not know.
+var ErrInvalidWireKind = errors.New("invalid wire kind")
+
+// WireKind is the low three bits of a field tag in self-describing mode. It
+// tells a reader how many bytes the field occupies without knowing its Go
+// type.
+type WireKind uint8
+
+const (
+	// WireFixed1 .. WireFixed8 are little-endian values of 1, 2, 4 and 8
+	// bytes (bools, integers, floats).
+	WireFixed1 WireKind = iota
+	WireFixed2
+	WireFixed4
+	WireFixed8
+	// WireBytes is a VarInt byte length followed by that many bytes:
+	// the raw bytes of a string, the encoding of a nested struct, or the
+	// regular encoding of any other value (slices, maps, arrays, pointers).
+	WireBytes
+)
+
+func (k WireKind) String() string {
+	switch k {
+	case WireFixed1:
+		return "fixed1"
+	case WireFixed2:
+		return "fixed2"
+	case WireFixed4:
+		return "fixed4"
+	case WireFixed8:
+		return "fixed8"
+	case WireBytes:
+		return "bytes"
+	default:
+		return "invalid"
+	}
+}
+
+// wireKindOf picks the wire kind for values described by info.
+func wireKindOf(info *FieldInfo) WireKind {
+	if info.isVar || info.kind == reflect.Array {
+		return WireBytes
+	}
+	switch info.size {
+	case 1:
+		return WireFixed1
+	case 2:
+		return WireFixed2
+	case 4:
+		return WireFixed4
+	default:
+		return WireFixed8
+	}
+}
+
+// selfPrefixed reports whether the regular encoding of info already starts
+// with a VarInt byte length, so it can be used as a WireBytes payload as is.
+func selfPrefixed(info *FieldInfo) bool {
+	return info.custom || info.kind == reflect.String || info.kind == reflect.Struct
+}
+
+// RawField is one field of a self-describing struct encoding.
+type RawField struct {
+	ID   int
+	Wire WireKind
+	// Value holds the fixed-size bytes, or the payload of a WireBytes field
+	// without its length prefix.
+	Value []byte
+}
+
+// ReadFields splits a struct written in self-describing mode into its
+// fields without needing the Go type, e.g. to dump or inspect a payload.
+// Nested structs are returned as WireBytes values and can be passed to
+// ReadFields again. Values alias b.
+func ReadFields(b []byte) ([]RawField, error) {
+	n, pos, err := readCountAt(b, 0, 1)
+	if err != nil {
+		return nil, decodeErr(0, -1, err)
+	}
+	fields := make([]RawField, 0, n)
+	for i := 0; i < n; i++ {
+		wf, err := readWireField(b, pos)
+		if err != nil {
+			return nil, decodeErr(wf.end, i, err)
+		}
+		fields = append(fields, RawField{ID: wf.id, Wire: wf.wire, Value: b[wf.start:wf.end]})
+		pos = wf.end
+	}
+	return fields, nil
+}
+
+// wireField locates one tagged field: the value follows the tag at `body`;
+// for WireBytes `start` skips the length prefix, otherwise start == body.
+type wireField struct {
+	id               int
+	wire             WireKind
+	body, start, end int
+}
+
+// readWireField reads the tag at b[pos] and locates the field value. On
+// error wf.end holds the offset where reading failed.
+func readWireField(b []byte, pos int) (wf wireField, err error) {
+	wf.end = pos
+	tag, next, err := readVarUintAt(b, pos)
+	if err != nil {
+		return wf, err
+	}
+	if tag>>3 > maxFieldID {
+		return wf, ErrInvalidTag
+	}
+	wf.id, wf.wire = int(tag>>3), WireKind(tag&7)
+	wf.body, wf.start, wf.end = next, next, next
+	switch wf.wire {
+	case WireFixed1, WireFixed2, WireFixed4, WireFixed8:
+		size := 1 << wf.wire
+		if len(b)-next < size {
+			return wf, ErrTruncated
+		}
+		wf.end = next + size
+	case WireBytes:
+		size, start, err := readCountAt(b, next, 1)
+		if err != nil {
+			return wf, err
+		}
+		wf.start, wf.end = start, start+size
+	default:
+		wf.end = pos
+		return wf, ErrInvalidWireKind
+	}
+	return wf, nil
+}
+
+// encodeTagged writes `v` in self-describing mode: the number of fields
+// written, then for each field a VarInt tag (id<<3 | wire kind) followed by
+// the value. Empty omitempty fields are simply not written.
+func (f *Fractus) encodeTagged(dst []byte, v reflect.Value, plan *FieldPlan) ([]byte, error) {
+	n := plan.fieldCount
+	if plan.hasOmit {
+		for i := range plan.fields {
+			if plan.fields[i].omitEmpty && isEmptyValue(v.Field(plan.fields[i].idx)) {
+				n--
+			}
+		}
+	}
+	dst = writeVarUint(dst, uint64(n))
+	var err error
+	for i := range plan.fields {
+		field := &plan.fields[i]
+		fieldValue := v.Field(field.idx)
+		if field.omitEmpty && isEmptyValue(fieldValue) {
+			continue
+		}
+		dst = writeVarUint(dst, uint64(field.id)<<3|uint64(field.wire))
+		if field.wire != WireBytes || selfPrefixed(field) {
+			dst, err = f.encodeValue(dst, fieldValue, field)
+		} else {
+			start := len(dst)
+			if dst, err = f.encodeValue(dst, fieldValue, field); err == nil {
+				dst = insertVarUint(dst, start, uint64(len(dst)-start))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
+
+// decodeTagged reads a self-describing struct into dst. Fields are matched
+// by id, in any order; unknown ids and fields whose wire kind no longer
+// matches the struct are skipped, and fields absent from the payload are
+// left at their zero value.
+func (f *Fractus) decodeTagged(in []byte, pos int, dst reflect.Value, plan *FieldPlan, depth int) (int, error) {
+	n, pos, err := readCountAt(in, pos, 1)
+	if err != nil {
+		return pos, err
+	}
+	for i := range plan.fields {
+		dst.Field(plan.fields[i].idx).SetZero()
+	}
+	for ; n > 0; n-- {
+		wf, err := readWireField(in, pos)
+		if err != nil {
+			return wf.end, err
+		}
+		i, found := slices.BinarySearchFunc(plan.fields, wf.id, func(fi FieldInfo, id int) int { return fi.id - id })
+		if found && plan.fields[i].wire == wf.wire {
+			field := &plan.fields[i]
+			// strings and structs read their own length prefix
+			from := wf.start
+			if selfPrefixed(field) {
+				from = wf.body
+			}
+			at, err := f.decodeValue(in[:wf.end], from, dst.Field(field.idx), field, depth+1)
+			if err != nil {
+				return at, fieldErr(at, field.idx, err)
+			}
+		}
+		pos = wf.end
+	}
+	return pos, nil
+}